@@ -0,0 +1,143 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/howeyc/gopass"
+	"github.com/spf13/cobra"
+)
+
+var deleteBranch bool
+
+// branchCmd represents the branch command
+var branchCmd = &cobra.Command{
+	Use:   "branch [name] [version]",
+	Short: "list, create or delete branches",
+	Long: `without argument list the branches of the repository, the one followed
+by the current directory is marked with a star. With a name create a
+branch starting at the given version, the version of the current
+directory by default, or delete it with -d.`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		branch(args)
+	},
+	Example: `imagehub branch
+imagehub branch cleanup
+imagehub branch -d cleanup`,
+}
+
+// switchCmd represents the switch command
+var switchCmd = &cobra.Command{
+	Use:   "switch <branch>",
+	Short: "follow another branch",
+	Long: `update the current directory to the head of the given branch, the
+next pull and push will use it.`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		update(args[0])
+	},
+	Example: `imagehub switch cleanup`,
+}
+
+func init() {
+	rootCmd.AddCommand(branchCmd)
+	rootCmd.AddCommand(switchCmd)
+
+	branchCmd.Flags().BoolVarP(&deleteBranch, "delete", "d", false, "delete the branch")
+	switchCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "discard the local changes to the updated files")
+}
+
+func branch(args []string) {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	if len(args) == 0 {
+		resp, err := c.ListBranches(context.Background(), &pb.ListBranchesRequest{
+			Owner:      reposInfo.Owner,
+			FolderName: reposInfo.FolderName,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, b := range resp.GetBranches() {
+			// the first branch is the default one, followed by older clones
+			current := b.GetName() == reposInfo.Branch || (i == 0 && reposInfo.Branch == "")
+			mark := " "
+			if current {
+				mark = "*"
+			}
+			fmt.Printf("%s %-20s %s\n", mark, b.GetName(), shortDigest(b.GetDigest()))
+		}
+		return
+	}
+	if deleteBranch && len(args) > 1 {
+		log.Fatal("a version can't be given with -d")
+	}
+	var version string
+	if !deleteBranch {
+		if version, err = localVersion(c, reposInfo, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var username string
+	// ask the client to provide credentials
+	fmt.Print("Username: ")
+	fmt.Scanln(&username)
+	fmt.Print("Password: ")
+	password, _ := gopass.GetPasswd()
+	if deleteBranch {
+		resp, err := c.DeleteBranch(context.Background(), &pb.DeleteBranchRequest{
+			Username:   username,
+			Password:   string(password),
+			Owner:      reposInfo.Owner,
+			FolderName: reposInfo.FolderName,
+			Name:       args[0],
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("[+] Deleted branch %s (was %s)\n", resp.GetBranch().GetName(), resp.GetBranch().GetDigest())
+		return
+	}
+	resp, err := c.CreateBranch(context.Background(), &pb.CreateBranchRequest{
+		Username:   username,
+		Password:   string(password),
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+		Name:       args[0],
+		Version:    version,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Created branch %s at %s, use imagehub switch %s to follow it\n",
+		resp.GetBranch().GetName(), resp.GetBranch().GetDigest(), resp.GetBranch().GetName())
+}
@@ -19,11 +19,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/BENSARI-Fathi/imagehub/utils"
 	"github.com/BENSARI-Fathi/imagehub/v1/pb"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 // checkCmd represents the check command
@@ -54,7 +54,7 @@ func init() {
 }
 
 func check() {
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	cc, err := dial()
 	if err != nil {
 		log.Fatalf("Error while trying to connect %v", err)
 	}
@@ -65,16 +65,71 @@ func check() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	resp, err := checkVersion(c, reposInfo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(resp.GetStatus())
+}
+
+// checkVersion asks the server whether the local version is the head of
+// its branch. Clones made before version digests existed only know the
+// legacy hash, the digest the server resolves it to is recorded instead.
+func checkVersion(c pb.ImageReposClient, reposInfo *utils.ReposInfo) (*pb.CheckResponse, error) {
 	request := &pb.CheckRequest{
 		Metadata: &pb.MetaData{
 			Hash:       reposInfo.Hash,
+			Digest:     reposInfo.Digest,
 			Owner:      reposInfo.Owner,
 			FolderName: reposInfo.FolderName,
+			Branch:     reposInfo.Branch,
 		},
 	}
 	resp, err := c.Check(context.Background(), request)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	fmt.Println(resp.GetStatus())
+	if reposInfo.Digest != "" || resp.GetDigest() == "" {
+		return resp, nil
+	}
+	reposInfo.Hash = 0
+	reposInfo.Digest = resp.GetDigest()
+	binaryData, err := reposInfo.Marshall()
+	if err != nil {
+		return nil, err
+	}
+	return resp, os.WriteFile(utils.HiddenFile, binaryData, 0666)
+}
+
+// upgradeVersion records the digest of a clone that only knows the
+// legacy hash of its version.
+func upgradeVersion(c pb.ImageReposClient, reposInfo *utils.ReposInfo) error {
+	if reposInfo.Digest != "" || reposInfo.Hash == 0 {
+		return nil
+	}
+	_, err := checkVersion(c, reposInfo)
+	return err
+}
+
+// localVersion returns the version given on the command line, or the
+// digest of the local one.
+func localVersion(c pb.ImageReposClient, reposInfo *utils.ReposInfo, args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if err := upgradeVersion(c, reposInfo); err != nil {
+		return "", err
+	}
+	if reposInfo.Digest == "" {
+		return "", fmt.Errorf("the server doesn't know the local version of %s, give the version explicitly", reposInfo.ReposPath())
+	}
+	return reposInfo.Digest, nil
+}
+
+// shortDigest abbreviates a digest for listings.
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
 }
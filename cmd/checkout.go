@@ -0,0 +1,42 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// checkoutCmd represents the checkout command
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout <version>",
+	Short: "switch the local repository to another version",
+	Long: `download the changes between the local version and the given one
+and apply them to the current directory. The version is a digest or a
+digest prefix as shown by imagehub log, or a tag.`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		update(args[0])
+	},
+	Example: `imagehub checkout 7a28a0a1
+imagehub checkout v1.2`,
+}
+
+func init() {
+	rootCmd.AddCommand(checkoutCmd)
+
+	checkoutCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "discard the local changes to the updated files")
+}
@@ -16,19 +16,17 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/BENSARI-Fathi/imagehub/utils"
 	"github.com/BENSARI-Fathi/imagehub/v1/pb"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var url string
@@ -48,7 +46,10 @@ var cloneCmd = &cobra.Command{
 		return nil
 	},
 	Example: `imagehub clone http://localhost:5000/<username>/<repos>
-imagehub clone -u http://localhost:5000/<username>/<repos>`,
+imagehub clone -u http://localhost:5000/<username>/<repos>
+imagehub clone http://localhost:5000/<username>/<repos>@<version>
+imagehub clone http://localhost:5000/<username>/<repos>@<branch>
+imagehub clone --server staging <username>/<repos>`,
 }
 
 func init() {
@@ -69,74 +70,71 @@ func clone(args []string) {
 	if url == "" {
 		url = args[0]
 	}
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	// a specific version can be asked with <url>@<version>
+	version := ""
+	if i := strings.LastIndex(url, "@"); i != -1 {
+		url, version = url[:i], url[i+1:]
+	}
+	server := remoteName(false)
+	cc, err := dialRemote(server)
 	if err != nil {
 		log.Fatalf("Error while trying to connect %v", err)
 	}
 	defer cc.Close()
 	c := pb.NewImageReposClient(cc)
-	req := &pb.CloneRequest{
-		ReposPath: url,
-	}
-	respStream, err := c.Clone(context.Background(), req)
-	if err != nil {
-		log.Fatal(err)
-	}
-	// receive the hash value if the repository exist
-	data, err := respStream.Recv()
-	if err != nil {
-		log.Fatalf("Error while reading stream %v\n", err)
-	}
-	//create directory
+	//create directory, or resume the interrupted clone of the same version
+	source := url + "@" + version
 	directoryPath := filepath.Base(url)
+	resumed := false
 	for {
 		if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
 			break
 		}
-		source := rand.NewSource(time.Now().UnixNano())
-		r := rand.New(source)
-		randomNumber := r.Int()
-		directoryPath = fmt.Sprintf("%s-%v", directoryPath, randomNumber)
+		marker, err := os.ReadFile(filepath.Join(directoryPath, utils.PartialDir, "clone"))
+		if err == nil && string(marker) == source {
+			resumed = true
+			break
+		}
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		directoryPath = fmt.Sprintf("%s-%v", directoryPath, r.Int())
 	}
-
-	err = os.Mkdir(directoryPath, 0755)
-	if err != nil {
-		log.Fatal(err)
+	if !resumed {
+		err = os.MkdirAll(filepath.Join(directoryPath, utils.PartialDir), 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(directoryPath, utils.PartialDir, "clone"), []byte(source), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	err = os.Chdir(directoryPath)
+	// the directory only holds what an interrupted clone wrote
+	result, err := fetch(c, url, version, directoryPath, nil, parallel, true)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("%v\nRun the same command again to resume the clone into %s", err, directoryPath)
 	}
+	os.RemoveAll(filepath.Join(directoryPath, utils.PartialDir))
 
-	// save the repository hash in local file
+	// save the repository version in local file
 	metadata := &utils.ReposInfo{
-		Hash:       data.GetMetadata().GetHash(),
-		Owner:      data.GetMetadata().GetOwner(),
-		FolderName: data.GetMetadata().GetFolderName(),
+		Digest:     result.metadata.GetDigest(),
+		Owner:      result.metadata.GetOwner(),
+		FolderName: result.metadata.GetFolderName(),
+		Branch:     result.metadata.GetBranch(),
+		// later commands in the clone talk to the same server
+		Remote: server,
 	}
 	binaryData, err := metadata.Marshall()
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = os.WriteFile(utils.HiddenFile, binaryData, 0666)
+	err = os.WriteFile(filepath.Join(directoryPath, utils.HiddenFile), binaryData, 0666)
 	if err != nil {
 		log.Fatal(err)
 	}
-	// setup the zipfile
-	f, err := os.Create(directoryPath + ".zip")
+	err = result.manifest.WriteFile(filepath.Join(directoryPath, utils.ManifestFile))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
-	for {
-		data, err := respStream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Fatalf("Error while reading stream %v\n", err)
-		}
-		f.Write(data.GetChunkData())
-	}
-	fmt.Println("[+] Cloned successfully")
+	fmt.Printf("[+] Cloned successfully into %s\n", directoryPath)
 }
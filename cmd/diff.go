@@ -0,0 +1,163 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [version] [version]",
+	Short: "show the changes between versions",
+	Long: `list the added, removed, modified and renamed images between two
+versions with their size and dimensions.
+
+Without argument the working directory is compared with the version of
+the clone, with one argument the given version is compared with the
+version of the clone.`,
+	Args:                  cobra.MaximumNArgs(2),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		diff(args)
+	},
+	Example: `imagehub diff
+imagehub diff 7a28a0a1
+imagehub diff 7a28a0a1 c3f1be29`,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
+
+func diff(args []string) {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) == 0 {
+		changes, err := workingDiff()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("diff %s..working directory\n", reposInfo.Digest)
+		printFileChanges(changes)
+		return
+	}
+	request := &pb.DiffRequest{
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+		From:       args[0],
+		To:         reposInfo.Digest,
+	}
+	if len(args) == 2 {
+		request.To = args[1]
+	}
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	resp, err := c.Diff(context.Background(), request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("diff %s..%s\n", resp.GetFrom(), resp.GetTo())
+	printFileChanges(resp.GetChanges())
+}
+
+// workingDiff describes the local changes like the server does, only the
+// dimensions of the local files are known.
+func workingDiff() ([]*pb.FileChange, error) {
+	recorded, _, changes, err := localChanges()
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]store.Entry, len(recorded.Entries))
+	for _, e := range recorded.Entries {
+		before[e.Path] = e
+	}
+	var fileChanges []*pb.FileChange
+	for _, e := range changes.Added {
+		fileChanges = append(fileChanges, &pb.FileChange{Kind: pb.ChangeKind_Added, After: localInfo(e)})
+	}
+	for _, e := range changes.Removed {
+		fileChanges = append(fileChanges, &pb.FileChange{Kind: pb.ChangeKind_Removed, Before: entryInfo(e)})
+	}
+	for _, e := range changes.Modified {
+		fileChanges = append(fileChanges, &pb.FileChange{
+			Kind:   pb.ChangeKind_Modified,
+			Before: entryInfo(before[e.Path]),
+			After:  localInfo(e),
+		})
+	}
+	for _, r := range changes.Renamed {
+		fileChanges = append(fileChanges, &pb.FileChange{
+			Kind:   pb.ChangeKind_Renamed,
+			Before: entryInfo(r.From),
+			After:  localInfo(r.To),
+		})
+	}
+	return fileChanges, nil
+}
+
+func entryInfo(e store.Entry) *pb.FileInfo {
+	return &pb.FileInfo{Path: e.Path, Digest: e.Digest, Size: e.Size}
+}
+
+func localInfo(e store.Entry) *pb.FileInfo {
+	info := entryInfo(e)
+	width, height := store.FileDimensions(e.Path)
+	info.Width, info.Height = int32(width), int32(height)
+	return info
+}
+
+func printFileChanges(changes []*pb.FileChange) {
+	if len(changes) == 0 {
+		fmt.Println("no changes")
+		return
+	}
+	for _, change := range changes {
+		before, after := change.GetBefore(), change.GetAfter()
+		switch change.GetKind() {
+		case pb.ChangeKind_Added:
+			fmt.Printf("\tadded:    %s (%s)\n", after.GetPath(), describe(after))
+		case pb.ChangeKind_Removed:
+			fmt.Printf("\tremoved:  %s (%s)\n", before.GetPath(), describe(before))
+		case pb.ChangeKind_Modified:
+			fmt.Printf("\tmodified: %s (%s -> %s)\n", after.GetPath(), describe(before), describe(after))
+		case pb.ChangeKind_Renamed:
+			fmt.Printf("\trenamed:  %s -> %s (%s)\n", before.GetPath(), after.GetPath(), describe(after))
+		}
+	}
+}
+
+// describe returns the size and, when known, the dimensions of a file.
+func describe(info *pb.FileInfo) string {
+	if info.GetWidth() == 0 {
+		return formatSize(info.GetSize())
+	}
+	return fmt.Sprintf("%s, %dx%d", formatSize(info.GetSize()), info.GetWidth(), info.GetHeight())
+}
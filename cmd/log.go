@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/spf13/cobra"
+)
+
+// logCmd represents the log command
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "show the version history of the repository",
+	Long: `list every version pushed to the branch of the current directory,
+newest first.`,
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		showLog()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+}
+
+func showLog() {
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	reposInfo := &utils.ReposInfo{}
+	err = reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	request := &pb.HistoryRequest{
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+		Branch:     reposInfo.Branch,
+	}
+	resp, err := c.History(context.Background(), request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, version := range resp.GetVersions() {
+		current := ""
+		if version.GetDigest() == reposInfo.Digest {
+			current = " (current)"
+		}
+		fmt.Printf("version %s%s\n", version.GetDigest(), current)
+		fmt.Printf("Author: %s\n", version.GetAuthor())
+		fmt.Printf("Date:   %s\n", time.Unix(version.GetTimestamp(), 0).Format(time.RFC1123))
+		if version.GetParent() != "" {
+			fmt.Printf("Parent: %s\n", version.GetParent())
+		}
+		fmt.Printf("Files:  %d (%s)\n\n", version.GetFileCount(), formatSize(version.GetSize()))
+		if version.GetMessage() != "" {
+			fmt.Printf("    %s\n\n", version.GetMessage())
+		}
+	}
+}
+
+// formatSize returns a human readable size.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// progress reports a transfer as it goes: a bar redrawn in place on a
+// terminal, a line every tenth of the way otherwise.
+type progress struct {
+	label string
+	total int64
+	files int
+	tty   bool
+	start time.Time
+
+	mu        sync.Mutex
+	done      int64
+	doneFiles int
+	drawn     time.Time
+	step      int64
+	printed   string
+}
+
+// newProgress starts reporting a transfer of total bytes, files is the
+// number of files to count when known.
+func newProgress(label string, total int64, files int) *progress {
+	return &progress{
+		label: label,
+		total: total,
+		files: files,
+		tty:   terminal.IsTerminal(int(os.Stdout.Fd())),
+		start: time.Now(),
+	}
+}
+
+// add counts n more bytes, negative when a failed attempt is given back.
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.update()
+}
+
+// fileDone counts n more completed files.
+func (p *progress) fileDone(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.doneFiles += n
+	p.update()
+}
+
+// finish prints the final state of the transfer.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Printf("\r%s\n", p.line())
+	} else if line := p.line(); line != p.printed {
+		fmt.Println(line)
+	}
+}
+
+func (p *progress) update() {
+	if p.tty {
+		// redrawing is throttled, parallel streams report very often
+		if time.Since(p.drawn) < 100*time.Millisecond {
+			return
+		}
+		p.drawn = time.Now()
+		fmt.Printf("\r%s", p.line())
+		return
+	}
+	if p.total <= 0 {
+		return
+	}
+	if step := p.done * 10 / p.total; step > p.step {
+		p.step = step
+		p.printed = p.line()
+		fmt.Println(p.printed)
+	}
+}
+
+func (p *progress) line() string {
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	elapsed := time.Since(p.start).Seconds()
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+	eta := "--"
+	if rate > 0 && p.done < p.total {
+		eta = (time.Duration(float64(p.total-p.done)/rate) * time.Second).Round(time.Second).String()
+	}
+	label := p.label
+	if p.tty {
+		width := 30
+		filled := int(percent) * width / 100
+		label += " [" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+	}
+	line := fmt.Sprintf("%s %3d%% %s / %s  %s/s  ETA %s",
+		label, percent, formatSize(p.done), formatSize(p.total), formatSize(int64(rate)), eta)
+	if p.files > 0 {
+		line += fmt.Sprintf("  %d/%d file(s)", p.doneFiles, p.files)
+	}
+	if p.tty {
+		// clear what a longer previous line left behind
+		line += "   "
+	}
+	return line
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/spf13/cobra"
+)
+
+// pullCmd represents the pull command
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "update the local repository to the latest version",
+	Long: `fetch the changes made on the branch of the local repository since
+its version and apply them: new and modified images are downloaded,
+removed ones are deleted. The update stops when it would overwrite or
+delete files changed locally, unless --force is given.`,
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		update("")
+	},
+}
+
+// updateForce discards the local changes to the files an update replaces
+var updateForce bool
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+
+	pullCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "discard the local changes to the updated files")
+}
+
+// update moves the local repository to the target version, the head of
+// its branch when target is empty. A branch target is followed from then on.
+// Files already downloaded by an interrupted update are kept.
+func update(target string) {
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	reposInfo := &utils.ReposInfo{}
+	err = reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if target == "" {
+		target = reposInfo.Branch
+	}
+	url := reposInfo.ReposPath()
+	// the manifest of our version tells which files the target removed
+	recorded, err := recordedManifest(c, reposInfo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if recorded == nil {
+		fmt.Println("Warning: this repository has no recorded version, images removed remotely are kept")
+	}
+	result, err := fetch(c, url, target, ".", recorded, parallel, updateForce)
+	var conflict *conflictError
+	if errors.As(err, &conflict) {
+		log.Fatal(err)
+	}
+	if err != nil {
+		log.Fatalf("%v\nRun the same command again to resume the download", err)
+	}
+	head := result.metadata
+	err = result.manifest.WriteFile(utils.ManifestFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if head.GetDigest() == reposInfo.Digest && (head.GetBranch() == "" || head.GetBranch() == reposInfo.Branch) {
+		fmt.Printf("Already at %s\n", head.GetDigest())
+		return
+	}
+	// remember the version we are now at, and the branch we follow
+	reposInfo.Hash = 0
+	reposInfo.Digest = head.GetDigest()
+	if head.GetBranch() != "" {
+		reposInfo.Branch = head.GetBranch()
+	}
+	binaryData, err := reposInfo.Marshall()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(utils.HiddenFile, binaryData, 0666)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Updated to %s: %d file(s) downloaded, %d removed\n", head.GetDigest(), result.updated, result.removed)
+}
@@ -16,22 +16,30 @@ limitations under the License.
 package cmd
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"math/rand"
 	"os"
-	"strings"
-	"time"
+	"path/filepath"
+	"sort"
+	"sync"
 
+	"github.com/BENSARI-Fathi/imagehub/store"
 	"github.com/BENSARI-Fathi/imagehub/utils"
 	"github.com/BENSARI-Fathi/imagehub/v1/pb"
 	"github.com/howeyc/gopass"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	pushMessage string
+	pushForce   bool
 )
 
 // pushCmd represents the push command
@@ -40,7 +48,17 @@ var pushCmd = &cobra.Command{
 	Short: "push your local repository to a remote server",
 	Long: `push your local repository to a remote server. For example:
 
-imagehub push http://<servername>/<username>/<repositoryName>`,
+imagehub push http://<servername>/<username>/<repositoryName>
+imagehub push -m "relabelled tigers" http://<servername>/<username>/<repositoryName>
+
+The versions are pushed to the branch the directory follows. The push is
+refused when someone else pushed since the version you started from,
+pull first or use --force to replace their versions. Only the images the
+server doesn't already have are uploaded, an interrupted push resumes
+the images it cut short when run again.
+
+Files matching the gitignore style patterns of .imagehubignore, in the
+repository or in your home directory, are not pushed.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		push(args)
 	},
@@ -57,18 +75,18 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// pushCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	pushCmd.Flags().StringVarP(&pushMessage, "message", "m", "", "describe the changes of this version")
+	pushCmd.Flags().BoolVarP(&pushForce, "force", "f", false, "push even if the remote repository moved on")
 }
 
 func push(args []string) {
 
 	var (
-		username, fsum string
-		fileList       []string
-		localZip       = "imagehub.zip"
+		username string
+		fileList []string
 	)
 	// setup grpc client
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	cc, err := dial()
 	if err != nil {
 		log.Fatalf("Error while trying to connect %v", err)
 	}
@@ -76,86 +94,396 @@ func push(args []string) {
 	c := pb.NewImageReposClient(cc)
 
 	remoteRepos := args[0]
-	// calculate the hash
-	files, err := ioutil.ReadDir("./")
+	// calculate the version digest from the files content
+	fileList, err = utils.RepoFiles(".")
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, file := range files {
-		fsum += file.Name()
-		fileList = append(fileList, file.Name())
+	manifest, err := store.Scan(".", fileList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the version this directory was cloned or last pushed at
+	reposInfo := &utils.ReposInfo{}
+	if _, err := os.Stat(utils.HiddenFile); err == nil {
+		if err = reposInfo.Unmarshall(utils.HiddenFile); err != nil {
+			log.Fatal(err)
+		}
+		// older clones only know the legacy hash of their version
+		if err = upgradeVersion(c, reposInfo); err != nil {
+			log.Fatal(err)
+		}
 	}
-	hash := utils.Hash(fsum)
 	// ask the client to provide credentials
 	fmt.Print("Username: ")
 	fmt.Scanln(&username)
 	fmt.Print("Password: ")
 	password, _ := gopass.GetPasswd()
-	// create the zip
-	for {
-		if _, err := os.Stat(localZip); os.IsNotExist(err) {
-			break
+	info := &pb.UserCredentials{
+		Username:  username,
+		Password:  string(password),
+		ReposPath: remoteRepos,
+		Digest:    manifest.Digest(),
+		Message:   pushMessage,
+		Base:      reposInfo.Digest,
+		Force:     pushForce,
+		Branch:    reposInfo.Branch,
+	}
+	// only the images the server doesn't have are uploaded, those stored
+	// by an interrupted push are not sent again
+	var resp *pb.PushResponse
+	files, err := missingFiles(c, username, string(password), manifest)
+	if status.Code(err) == codes.Unimplemented {
+		// older servers only take a zip of every file
+		fmt.Printf("Uploading %d file(s)\n", len(fileList))
+		resp, err = pushZip(c, info, fileList)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the files an interrupted push cut short resume where they stopped
+		session, err := openUploadSession(info.Digest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		info.UploadId = session.ID
+		info.Blobs = true
+		fmt.Printf("Uploading %d of %d file(s)\n", len(files), len(fileList))
+		entries := make([]*pb.FileHeader, 0, len(manifest.Entries))
+		for _, e := range manifest.Entries {
+			entries = append(entries, &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size})
 		}
-		source := rand.NewSource(time.Now().UnixNano())
-		r := rand.New(source)
-		randomNumber := r.Int()
-		fname := strings.Split(localZip, ".")
-		localZip = fmt.Sprintf("%s-%v.%s", fname[0], randomNumber, fname[1])
+		resp, err = sendFiles(c, info, entries, manifest, files)
+		switch {
+		case err == nil:
+		case status.Code(err) == codes.FailedPrecondition:
+			// someone pushed since our version, sending again won't help
+			log.Fatalf("%v\nRun imagehub pull first, or push with --force to replace the remote versions", err)
+		case retryable(err):
+			log.Fatalf("%v\nRun the same command again to resume the push", err)
+		default:
+			log.Fatal(err)
+		}
+		session.remove()
+	}
+	fmt.Println(resp.GetResult())
+	// the pushed version is the base of the next push
+	if resp.GetMetadata() == nil {
+		return
 	}
-	f, err := os.Create(localZip)
-	defer f.Close()
-	err = utils.CreateFlatZip(f, fileList...)
+	// a one-off --server doesn't change the remote the directory follows
+	reposInfo = &utils.ReposInfo{
+		Digest:     resp.GetMetadata().GetDigest(),
+		Owner:      resp.GetMetadata().GetOwner(),
+		FolderName: resp.GetMetadata().GetFolderName(),
+		Branch:     resp.GetMetadata().GetBranch(),
+		Remote:     reposInfo.Remote,
+	}
+	binaryData, err := reposInfo.Marshall()
 	if err != nil {
 		log.Fatal(err)
 	}
-	// reset the file cursor to the begining of the file
-	f.Seek(0, 0)
-	// send the metadata
+	if err = os.WriteFile(utils.HiddenFile, binaryData, 0666); err != nil {
+		log.Fatal(err)
+	}
+	if err = manifest.WriteFile(utils.ManifestFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// missingFiles asks the server which contents of manifest it is missing
+// and returns one file for each of them.
+func missingFiles(c pb.ImageReposClient, username, password string, manifest *store.Manifest) ([]string, error) {
+	paths := map[string]string{}
+	req := &pb.MissingBlobsRequest{Username: username, Password: password}
+	for _, e := range manifest.Entries {
+		if _, ok := paths[e.Digest]; !ok {
+			paths[e.Digest] = e.Path
+			req.Digests = append(req.Digests, e.Digest)
+		}
+	}
+	resp, err := c.MissingBlobs(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, digest := range resp.GetMissing() {
+		p, ok := paths[digest]
+		if !ok {
+			return nil, fmt.Errorf("the server asked for the unknown content %s", digest)
+		}
+		files = append(files, p)
+	}
+	return files, nil
+}
+
+// splitFiles spreads files over at most n groups of about the same size.
+func splitFiles(manifest *store.Manifest, files []string, n int) [][]string {
+	sizes := make(map[string]int64, len(manifest.Entries))
+	for _, e := range manifest.Entries {
+		sizes[e.Path] = e.Size
+	}
+	sorted := append([]string{}, files...)
+	sort.Slice(sorted, func(i, j int) bool { return sizes[sorted[i]] > sizes[sorted[j]] })
+	if n < 1 {
+		n = 1
+	}
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	groups := make([][]string, n)
+	totals := make([]int64, n)
+	// the largest files first, each in the lightest group
+	for _, f := range sorted {
+		lightest := 0
+		for i := range totals {
+			if totals[i] < totals[lightest] {
+				lightest = i
+			}
+		}
+		groups[lightest] = append(groups[lightest], f)
+		totals[lightest] += sizes[f]
+	}
+	return groups
+}
+
+// sendFiles uploads files on up to parallel concurrent streams, then sends
+// the push creating the version from entries, with them and the contents
+// the server already had.
+func sendFiles(c pb.ImageReposClient, info *pb.UserCredentials, entries []*pb.FileHeader, manifest *store.Manifest, files []string) (*pb.PushResponse, error) {
+	byPath := make(map[string]store.Entry, len(manifest.Entries))
+	for _, e := range manifest.Entries {
+		byPath[e.Path] = e
+	}
+	var total int64
+	for _, f := range files {
+		total += byPath[f].Size
+	}
+	var p *progress
+	if len(files) > 0 {
+		p = newProgress("Sending", total, len(files))
+	}
+	groups := splitFiles(manifest, files, parallel)
+	errs := make(chan error, len(groups))
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []string) {
+			defer wg.Done()
+			errs <- sendGroup(c, info, byPath, group, p)
+		}(group)
+	}
+	wg.Wait()
+	close(errs)
+	if p != nil {
+		p.finish()
+	}
+	for err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := upload(c, info, entries, nil, nil, nil)
+		if err == nil || !retryable(err) || attempt == maxAttempts {
+			return resp, err
+		}
+		log.Printf("Push interrupted (%v), retrying", err)
+		backoff(attempt)
+	}
+}
+
+// sendGroup uploads a group of files on its own stream. When the stream
+// breaks, the files the server stored meanwhile are not sent again.
+func sendGroup(c pb.ImageReposClient, info *pb.UserCredentials, byPath map[string]store.Entry, group []string, p *progress) error {
+	info = proto.Clone(info).(*pb.UserCredentials)
+	info.Partial = true
+	for attempt := 1; ; attempt++ {
+		_, err := upload(c, info, nil, byPath, group, p)
+		if err == nil {
+			return nil
+		}
+		if !retryable(err) || attempt == maxAttempts {
+			return err
+		}
+		log.Printf("Push interrupted (%v), resuming", err)
+		backoff(attempt)
+		pending := &store.Manifest{}
+		for _, f := range group {
+			pending.Entries = append(pending.Entries, byPath[f])
+		}
+		if group, err = missingFiles(c, info.GetUsername(), info.GetPassword(), pending); err != nil {
+			return err
+		}
+	}
+}
+
+// upload sends the entries of the version then files one after the other
+// on a push stream, each chunk with its checksum and the stream closed by
+// a trailer.
+func upload(c pb.ImageReposClient, info *pb.UserCredentials, entries []*pb.FileHeader, byPath map[string]store.Entry, files []string, p *progress) (resp *pb.PushResponse, err error) {
 	stream, err := c.Push(context.Background())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	err = stream.Send(&pb.PushRequest{
-		Data: &pb.PushRequest_Info{
-			Info: &pb.UserCredentials{
-				Username:  username,
-				Password:  string(password),
-				ReposPath: remoteRepos,
-				Hash:      hash,
-			},
-		},
+		Data: &pb.PushRequest_Info{Info: info},
 	})
+	if err == io.EOF {
+		// refused before any data, the answer tells why
+		return stream.CloseAndRecv()
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	// send the zip file chunk by chunk
-	r := bufio.NewReader(f)
-	buffer := make([]byte, 0, 4*1024)
-	for {
-		n, err := r.Read(buffer[:cap(buffer)])
+	// one entry per message, a large version doesn't fit in one
+	for _, e := range entries {
+		err = stream.Send(&pb.PushRequest{
+			Data: &pb.PushRequest_Entry{Entry: e},
+		})
+		if err == io.EOF {
+			return stream.CloseAndRecv()
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Fatal(err)
+			return nil, err
+		}
+	}
+	// the files an interrupted attempt cut short resume where they stopped
+	offsets := map[string]int64{}
+	if len(files) > 0 && info.GetUploadId() != "" {
+		if offsets, err = uploadOffsets(c, info.GetUploadId()); err != nil {
+			return nil, err
+		}
+	}
+	// the progress of a failed attempt is given back
+	var sent, resumed int64
+	var sentFiles int
+	defer func() {
+		if err != nil && p != nil {
+			p.add(-sent - resumed)
+			p.fileDone(-sentFiles)
+		}
+	}()
+	h := sha256.New()
+	buffer := make([]byte, transferChunkSize())
+	for _, file := range files {
+		e := byPath[file]
+		offset := offsets[e.Digest]
+		if offset > e.Size {
+			offset = 0
 		}
-		buffer = buffer[:n]
 		err = stream.Send(&pb.PushRequest{
-			Data: &pb.PushRequest_ChunkData{
-				ChunkData: buffer,
+			Data: &pb.PushRequest_File{
+				File: &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size, Offset: offset},
 			},
 		})
 		if err == io.EOF {
-			break
+			// the server stopped reading, its answer tells why
+			return stream.CloseAndRecv()
 		}
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		f, err := os.Open(filepath.FromSlash(file))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		resumed += offset
+		p.add(offset)
+		for {
+			n, rerr := io.ReadFull(f, buffer)
+			if n > 0 {
+				err = stream.Send(&pb.PushRequest{
+					Data: &pb.PushRequest_Chunk{
+						Chunk: &pb.Chunk{Offset: offset, Data: buffer[:n], Checksum: utils.Checksum(buffer[:n])},
+					},
+				})
+				if err != nil {
+					break
+				}
+				h.Write(buffer[:n])
+				offset += int64(n)
+				sent += int64(n)
+				p.add(int64(n))
+			}
+			if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+				break
+			}
+			if rerr != nil {
+				err = rerr
+				break
+			}
+		}
+		f.Close()
+		if err == io.EOF {
+			return stream.CloseAndRecv()
+		}
+		if err != nil {
+			return nil, err
 		}
+		sentFiles++
+		p.fileDone(1)
+	}
+	err = stream.Send(&pb.PushRequest{
+		Data: &pb.PushRequest_Trailer{
+			Trailer: &pb.Trailer{Size: sent, Digest: hex.EncodeToString(h.Sum(nil))},
+		},
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// pushZip sends every file in a zip archive, for servers that can't tell
+// which ones they are missing. The push can't be resumed.
+func pushZip(c pb.ImageReposClient, info *pb.UserCredentials, files []string) (*pb.PushResponse, error) {
+	stream, err := c.Push(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	err = stream.Send(&pb.PushRequest{
+		Data: &pb.PushRequest_Info{Info: info},
+	})
+	if err == io.EOF {
+		return stream.CloseAndRecv()
 	}
-	resp, err := stream.CloseAndRecv()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	fmt.Println(resp.GetResult())
-	os.Remove(localZip)
+	// the archive is built while it is sent
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(utils.CreateZip(pw, files...))
+	}()
+	buffer := make([]byte, transferChunkSize())
+	for {
+		n, rerr := io.ReadFull(pr, buffer)
+		if n > 0 {
+			err = stream.Send(&pb.PushRequest{
+				Data: &pb.PushRequest_ChunkData{ChunkData: buffer[:n]},
+			})
+			if err == io.EOF {
+				return stream.CloseAndRecv()
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+	}
+	return stream.CloseAndRecv()
 }
@@ -23,7 +23,6 @@ import (
 	"github.com/BENSARI-Fathi/imagehub/v1/pb"
 	"github.com/howeyc/gopass"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 // registerCmd represents the register command
@@ -57,7 +56,7 @@ func register() {
 
 	var username, email string
 
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	cc, err := dial()
 	if err != nil {
 		log.Fatalf("Error while trying to connect %v", err)
 	}
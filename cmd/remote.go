@@ -0,0 +1,234 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+// defaultServer is used when no server is configured.
+const defaultServer = "localhost:50051"
+
+var remoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// remoteCmd represents the remote command
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "list the servers known by name",
+	Long: `list the servers saved in the config file under a name. A name can be
+used wherever a server is expected. The server of a command is, in order:
+
+  --server, the IMAGEHUB_SERVER environment variable, the remote the
+  repository of the current directory was cloned from, the server key of
+  the config file, then ` + defaultServer + `.`,
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		listRemotes()
+	},
+}
+
+// remoteAddCmd represents the remote add command
+var remoteAddCmd = &cobra.Command{
+	Use:                   "add <name> <host:port>",
+	Short:                 "save a server under a name",
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		addRemote(args[0], args[1])
+	},
+	Example: `imagehub remote add staging staging.example.com:50051
+imagehub clone --server staging http://staging.example.com:5000/<username>/<repos>`,
+}
+
+// remoteRemoveCmd represents the remote remove command
+var remoteRemoveCmd = &cobra.Command{
+	Use:                   "remove <name>",
+	Short:                 "forget a saved server",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		removeRemote(args[0])
+	},
+}
+
+// remoteUseCmd represents the remote use command
+var remoteUseCmd = &cobra.Command{
+	Use:                   "use <name>",
+	Short:                 "change the server of the local repository",
+	Long:                  `make the repository of the current directory use another server from now on.`,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		useRemote(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(remoteCmd)
+	remoteCmd.AddCommand(remoteAddCmd)
+	remoteCmd.AddCommand(remoteRemoveCmd)
+	remoteCmd.AddCommand(remoteUseCmd)
+}
+
+func listRemotes() {
+	remotes := viper.GetStringMapString("remotes")
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	current := remoteName(true)
+	for _, name := range names {
+		mark := " "
+		if name == strings.ToLower(current) {
+			mark = "*"
+		}
+		fmt.Printf("%s %-20s %s\n", mark, name, remotes[name])
+	}
+	if len(names) == 0 {
+		fmt.Printf("No remote, using %s\n", serverAddress(current))
+	}
+}
+
+func addRemote(name, address string) {
+	if !remoteNamePattern.MatchString(name) {
+		log.Fatalf("Invalid remote name %q, use letters, digits, - and _", name)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		log.Fatalf("Invalid server address %q, expected host:port", address)
+	}
+	remotes := viper.GetStringMapString("remotes")
+	// viper keys are case insensitive
+	name = strings.ToLower(name)
+	if _, ok := remotes[name]; ok {
+		log.Fatalf("The remote %s already exists", name)
+	}
+	remotes[name] = address
+	viper.Set("remotes", remotes)
+	if err := saveConfig(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Remote %s added\n", name)
+}
+
+func removeRemote(name string) {
+	remotes := viper.GetStringMapString("remotes")
+	name = strings.ToLower(name)
+	if _, ok := remotes[name]; !ok {
+		log.Fatalf("Cannot find the remote %s", name)
+	}
+	delete(remotes, name)
+	viper.Set("remotes", remotes)
+	if err := saveConfig(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Remote %s removed\n", name)
+}
+
+func useRemote(name string) {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := viper.GetStringMapString("remotes")[strings.ToLower(name)]; !ok {
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			log.Fatalf("Cannot find the remote %s", name)
+		}
+	}
+	reposInfo.Remote = name
+	binaryData, err := reposInfo.Marshall()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(utils.HiddenFile, binaryData, 0666)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] The repository now uses %s\n", serverAddress(name))
+}
+
+// saveConfig writes the settings back to the config file, created in the
+// home directory when there is none yet.
+func saveConfig() error {
+	if viper.ConfigFileUsed() != "" {
+		if _, err := os.Stat(viper.ConfigFileUsed()); err == nil {
+			return viper.WriteConfig()
+		}
+	}
+	name := cfgFile
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		name = filepath.Join(home, ".imagehub.yaml")
+	}
+	return viper.WriteConfigAs(name)
+}
+
+// remoteName returns the server chosen for the command, a remote name or
+// an address. The remote of the local repository is only considered when
+// inRepo is set, a clone starts from the configured server.
+func remoteName(inRepo bool) string {
+	if serverFlag != "" {
+		return serverFlag
+	}
+	if server := os.Getenv("IMAGEHUB_SERVER"); server != "" {
+		return server
+	}
+	if _, err := os.Stat(utils.HiddenFile); inRepo && err == nil {
+		reposInfo := &utils.ReposInfo{}
+		if reposInfo.Unmarshall(utils.HiddenFile) == nil && reposInfo.Remote != "" {
+			return reposInfo.Remote
+		}
+	}
+	return viper.GetString("server")
+}
+
+// serverAddress returns the address of a remote, name is returned as is
+// when it is already an address.
+func serverAddress(name string) string {
+	if name == "" {
+		return defaultServer
+	}
+	if address, ok := viper.GetStringMapString("remotes")[strings.ToLower(name)]; ok {
+		return address
+	}
+	return name
+}
+
+// dial connects to the server of the command.
+func dial() (*grpc.ClientConn, error) {
+	return dialRemote(remoteName(true))
+}
+
+func dialRemote(name string) (*grpc.ClientConn, error) {
+	return grpc.Dial(serverAddress(name), grpc.WithInsecure())
+}
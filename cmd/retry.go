@@ -0,0 +1,53 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxAttempts is how many times a transfer is tried before giving up.
+const maxAttempts = 5
+
+// retryable reports whether a failed transfer may succeed when resumed. A
+// message over the size limit fails with ResourceExhausted every time.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.DeadlineExceeded, codes.OutOfRange, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// backoff waits before the next attempt, longer after each failure.
+func backoff(attempt int) {
+	time.Sleep(time.Duration(1<<attempt) * time.Second)
+}
+
+// transferChunkSize returns the --chunk-size asked, within what the server
+// accepts.
+func transferChunkSize() int {
+	switch {
+	case chunkSize < 4<<10:
+		return 4 << 10
+	case chunkSize > 1<<20:
+		return 1 << 20
+	}
+	return chunkSize
+}
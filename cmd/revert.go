@@ -0,0 +1,83 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/howeyc/gopass"
+	"github.com/spf13/cobra"
+)
+
+var revertMessage string
+
+// revertCmd represents the revert command
+var revertCmd = &cobra.Command{
+	Use:   "revert <version>",
+	Short: "bring back an older version of the repository",
+	Long: `push a new version on the branch of the current directory with the
+content of an older one. The history is kept, run imagehub pull
+afterwards to update the local files.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		revert(args[0])
+	},
+	Example: `imagehub revert 7a28a0a1
+imagehub revert -m "undo the bad relabelling" v1.2`,
+}
+
+func init() {
+	rootCmd.AddCommand(revertCmd)
+
+	revertCmd.Flags().StringVarP(&revertMessage, "message", "m", "", "describe why the version is reverted")
+}
+
+func revert(version string) {
+	var username string
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// ask the client to provide credentials
+	fmt.Print("Username: ")
+	fmt.Scanln(&username)
+	fmt.Print("Password: ")
+	password, _ := gopass.GetPasswd()
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	resp, err := c.Revert(context.Background(), &pb.RevertRequest{
+		Username:   username,
+		Password:   string(password),
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+		Version:    version,
+		Branch:     reposInfo.Branch,
+		Message:    revertMessage,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Reverted to %s, run imagehub pull to update the local files\n", resp.GetVersion().GetDigest())
+}
@@ -24,7 +24,15 @@ import (
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	// number of concurrent streams used by transfers
+	parallel int
+	// bytes of data per transferred message
+	chunkSize int
+	// server or remote name overriding the configured one
+	serverFlag string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -37,6 +45,12 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Version: "1.0.0",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if parallel < 1 {
+			return fmt.Errorf("--parallel must be at least 1, got %d", parallel)
+		}
+		return nil
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { fmt.Println("Hello CLI") },
@@ -56,6 +70,9 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.imagehub.yaml)")
+	rootCmd.PersistentFlags().IntVarP(&parallel, "parallel", "j", 4, "number of concurrent transfer streams")
+	rootCmd.PersistentFlags().StringVarP(&serverFlag, "server", "s", "", "server address or remote name (default $IMAGEHUB_SERVER or the configured one)")
+	rootCmd.PersistentFlags().IntVar(&chunkSize, "chunk-size", 256<<10, "bytes of data per transferred message, from 4 KiB to 1 MiB")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -78,6 +95,7 @@ func initConfig() {
 		viper.SetConfigName(".imagehub")
 	}
 
+	viper.SetEnvPrefix("imagehub")
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the local changes",
+	Long: `compare the images of the current directory with the version
+recorded by the last clone, pull or checkout and list the added,
+modified, deleted and renamed files. The server is only contacted when
+no version was recorded yet, for clones made by older clients.`,
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		showStatus()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+func showStatus() {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, _, changes, err := localChanges()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("On version %s\n", reposInfo.Digest)
+	if changes.Empty() {
+		fmt.Println("nothing to push, the working directory matches this version")
+		return
+	}
+	fmt.Println("Changes not pushed yet:")
+	printChanges(changes)
+}
+
+// localChanges compares the working directory with the manifest recorded
+// when the current version was fetched, it returns both manifests.
+func localChanges() (*store.Manifest, *store.Manifest, *store.Changes, error) {
+	recorded, err := store.ReadManifest(utils.ManifestFile)
+	if os.IsNotExist(err) {
+		recorded, err = fetchRecorded()
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if recorded == nil {
+		return nil, nil, nil, fmt.Errorf("no manifest recorded in this directory, run imagehub pull first")
+	}
+	files, err := utils.RepoFiles(".")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	working, err := store.Scan(".", files)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	changes := store.Compare(recorded, working)
+	changes.DetectRenames()
+	return recorded, working, changes, nil
+}
+
+// fetchRecorded downloads and records the manifest of the local version
+// when the directory has none, as after a clone made by an older client.
+func fetchRecorded() (*store.Manifest, error) {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		return nil, err
+	}
+	if reposInfo.Digest == "" && reposInfo.Hash == 0 {
+		return nil, nil
+	}
+	cc, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	return recordedManifest(c, reposInfo)
+}
+
+// recordedManifest returns the manifest of the local version, nil when
+// it is unknown. It is recorded for the next commands.
+func recordedManifest(c pb.ImageReposClient, reposInfo *utils.ReposInfo) (*store.Manifest, error) {
+	recorded, err := store.ReadManifest(utils.ManifestFile)
+	if !os.IsNotExist(err) {
+		return recorded, err
+	}
+	if err = upgradeVersion(c, reposInfo); err != nil {
+		return nil, err
+	}
+	if reposInfo.Digest == "" {
+		return nil, nil
+	}
+	current, err := fetchManifest(c, reposInfo.ReposPath(), reposInfo.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return current.manifest, current.manifest.WriteFile(utils.ManifestFile)
+}
+
+func printChanges(changes *store.Changes) {
+	for _, e := range changes.Added {
+		fmt.Printf("\tadded:    %s\n", e.Path)
+	}
+	for _, e := range changes.Modified {
+		fmt.Printf("\tmodified: %s\n", e.Path)
+	}
+	for _, e := range changes.Removed {
+		fmt.Printf("\tdeleted:  %s\n", e.Path)
+	}
+	for _, r := range changes.Renamed {
+		fmt.Printf("\trenamed:  %s -> %s\n", r.From.Path, r.To.Path)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/howeyc/gopass"
+	"github.com/spf13/cobra"
+)
+
+var tagMessage string
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag <name> [version]",
+	Short: "name a version of the repository",
+	Long: `give a permanent name to a version of the repository, the version of
+the current directory by default. The name can then be used wherever a
+version is expected, tags can't be moved or deleted.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		tag(args)
+	},
+	Example: `imagehub tag v1.2
+imagehub tag -m "dataset of the paper" v1.2 7a28a0a1
+imagehub clone http://localhost:5000/<username>/<repos>@v1.2`,
+}
+
+// tagsCmd represents the tags command
+var tagsCmd = &cobra.Command{
+	Use:                   "tags",
+	Short:                 "list the tags of the repository",
+	Long:                  `list the tags of the repository of the current directory, newest first.`,
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		listTags()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(tagsCmd)
+
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "describe the tagged version")
+}
+
+func tag(args []string) {
+	var username string
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	version, err := localVersion(c, reposInfo, args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	// ask the client to provide credentials
+	fmt.Print("Username: ")
+	fmt.Scanln(&username)
+	fmt.Print("Password: ")
+	password, _ := gopass.GetPasswd()
+	resp, err := c.Tag(context.Background(), &pb.TagRequest{
+		Username:   username,
+		Password:   string(password),
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+		Name:       args[0],
+		Version:    version,
+		Message:    tagMessage,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("[+] Tagged %s as %s\n", resp.GetTag().GetDigest(), resp.GetTag().GetName())
+}
+
+func listTags() {
+	reposInfo := &utils.ReposInfo{}
+	err := reposInfo.Unmarshall(utils.HiddenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cc, err := dial()
+	if err != nil {
+		log.Fatalf("Error while trying to connect %v", err)
+	}
+	defer cc.Close()
+	c := pb.NewImageReposClient(cc)
+	resp, err := c.ListTags(context.Background(), &pb.ListTagsRequest{
+		Owner:      reposInfo.Owner,
+		FolderName: reposInfo.FolderName,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range resp.GetTags() {
+		fmt.Printf("%-20s %s  %s  %s\n", t.GetName(), shortDigest(t.GetDigest()),
+			time.Unix(t.GetTimestamp(), 0).Format("2006-01-02"), t.GetMessage())
+	}
+}
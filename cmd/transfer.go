@@ -0,0 +1,535 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// receiver writes the blobs announced in a transfer stream into the
+// working directory. Each blob is received in the partial folder, where it
+// stays if the transfer is interrupted, and only moved to the paths using
+// it once its digest has been verified.
+type receiver struct {
+	root string
+	// paths still waiting for each blob
+	targets map[string][]string
+	header  *pb.FileHeader
+	part    *os.File
+	hash    hash.Hash
+	written int64
+	// progress counts what was received, may be nil
+	progress *progress
+}
+
+// errCorrupt is a transfer damaged on the way, downloading it again fixes it.
+var errCorrupt = errors.New("corrupted transfer")
+
+func (r *receiver) begin(header *pb.FileHeader) error {
+	if err := r.finish(); err != nil {
+		return err
+	}
+	if _, ok := r.targets[header.GetDigest()]; !ok || !store.ValidDigest(header.GetDigest()) {
+		return fmt.Errorf("received the unexpected blob %s", header.GetDigest())
+	}
+	if err := os.MkdirAll(r.path(utils.PartialDir), 0755); err != nil {
+		return err
+	}
+	name := r.partial(header.GetDigest())
+	h := sha256.New()
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if header.GetOffset() > 0 {
+		// resume the blob, what we already have goes into the digest first
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if n != header.GetOffset() {
+			return fmt.Errorf("cannot resume %s at %d, %d bytes were kept", header.GetPath(), header.GetOffset(), n)
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	part, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return err
+	}
+	r.header = header
+	r.part = part
+	r.hash = h
+	r.written = header.GetOffset()
+	return nil
+}
+
+// write appends a chunk of the current blob once its checksum and position
+// are checked.
+func (r *receiver) write(chunk *pb.Chunk) error {
+	if r.part == nil {
+		return fmt.Errorf("received data before any file header")
+	}
+	if utils.Checksum(chunk.GetData()) != chunk.GetChecksum() {
+		return fmt.Errorf("%w: the chunk at %d of %s", errCorrupt, chunk.GetOffset(), r.header.GetPath())
+	}
+	if chunk.GetOffset() != r.written {
+		return fmt.Errorf("%w: expected data of %s at %d got %d", errCorrupt, r.header.GetPath(), r.written, chunk.GetOffset())
+	}
+	r.hash.Write(chunk.GetData())
+	n, err := r.part.Write(chunk.GetData())
+	r.written += int64(n)
+	if r.progress != nil {
+		r.progress.add(int64(n))
+	}
+	return err
+}
+
+// finish verifies the current blob and puts it at every path using it.
+func (r *receiver) finish() error {
+	if r.part == nil {
+		return nil
+	}
+	part, header := r.part, r.header
+	r.part, r.header = nil, nil
+	if err := part.Close(); err != nil {
+		return err
+	}
+	if digest := hex.EncodeToString(r.hash.Sum(nil)); digest != header.GetDigest() {
+		os.Remove(part.Name())
+		if r.progress != nil {
+			// the blob is received again from the start
+			r.progress.add(-r.written)
+		}
+		return fmt.Errorf("%w: expected digest %s for %s got %s", errCorrupt, header.GetDigest(), header.GetPath(), digest)
+	}
+	// the blob is moved to its last path, copied to the others
+	paths := r.targets[header.GetDigest()]
+	for i, p := range paths {
+		var err error
+		if i == len(paths)-1 {
+			err = r.move(part.Name(), p)
+		} else {
+			err = r.place(part.Name(), p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.progress != nil {
+		r.progress.fileDone(len(paths))
+	}
+	delete(r.targets, header.GetDigest())
+	return nil
+}
+
+// move renames a verified blob to p, without copying it.
+func (r *receiver) move(blob, p string) error {
+	if !store.ValidPath(p) {
+		return fmt.Errorf("illegal file path: %s", p)
+	}
+	dest := r.path(p)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(blob, dest)
+}
+
+// place copies a verified blob to p, the file is replaced in one step.
+func (r *receiver) place(blob, p string) error {
+	if !store.ValidPath(p) {
+		return fmt.Errorf("illegal file path: %s", p)
+	}
+	dest := r.path(p)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	src, err := os.Open(blob)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".imagehub-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// abort stops receiving the current blob, what arrived is kept to resume.
+func (r *receiver) abort() {
+	if r.part != nil {
+		r.part.Close()
+		r.part, r.header = nil, nil
+	}
+}
+
+// missing returns the blobs still to receive, a partially received one
+// first with the number of bytes already there.
+func (r *receiver) missing() ([]string, int64) {
+	var digests []string
+	for digest := range r.targets {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	for i, digest := range digests {
+		if fi, err := os.Stat(r.partial(digest)); err == nil && fi.Size() > 0 {
+			digests[0], digests[i] = digests[i], digests[0]
+			return digests, fi.Size()
+		}
+	}
+	return digests, 0
+}
+
+// size returns the bytes of the blobs r still needs.
+func (r *receiver) size(m *store.Manifest) int64 {
+	var size int64
+	seen := map[string]bool{}
+	for _, e := range m.Entries {
+		if _, ok := r.targets[e.Digest]; ok && !seen[e.Digest] {
+			seen[e.Digest] = true
+			size += e.Size
+		}
+	}
+	return size
+}
+
+// split spreads the blobs of r over at most n receivers of about the same
+// size, each one can then use its own stream.
+func (r *receiver) split(m *store.Manifest, n int) []*receiver {
+	sizes := make(map[string]int64, len(m.Entries))
+	for _, e := range m.Entries {
+		sizes[e.Digest] = e.Size
+	}
+	digests := make([]string, 0, len(r.targets))
+	for digest := range r.targets {
+		digests = append(digests, digest)
+	}
+	sort.Slice(digests, func(i, j int) bool { return sizes[digests[i]] > sizes[digests[j]] })
+	if n < 1 {
+		n = 1
+	}
+	if n > len(digests) {
+		n = len(digests)
+	}
+	receivers := make([]*receiver, n)
+	totals := make([]int64, n)
+	for i := range receivers {
+		receivers[i] = &receiver{root: r.root, targets: map[string][]string{}, progress: r.progress}
+	}
+	// the largest blobs first, each in the lightest receiver
+	for _, digest := range digests {
+		lightest := 0
+		for i := range totals {
+			if totals[i] < totals[lightest] {
+				lightest = i
+			}
+		}
+		receivers[lightest].targets[digest] = r.targets[digest]
+		totals[lightest] += sizes[digest]
+	}
+	return receivers
+}
+
+// remove deletes a file and the folders it leaves empty.
+func (r *receiver) remove(p string) error {
+	if !store.ValidPath(p) {
+		return fmt.Errorf("illegal file path: %s", p)
+	}
+	err := os.Remove(r.path(p))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(r.path(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (r *receiver) path(p string) string {
+	return filepath.Join(r.root, filepath.FromSlash(p))
+}
+
+func (r *receiver) partial(digest string) string {
+	return filepath.Join(r.root, utils.PartialDir, digest)
+}
+
+// fetched sums up what fetch changed in the working directory.
+type fetched struct {
+	metadata *pb.MetaData
+	manifest *store.Manifest
+	updated  int
+	removed  int
+}
+
+// fetch brings root to the version ref of the repository at url. recorded
+// is the manifest of the version root is at, files it lists with the same
+// digest in both versions are left alone. Files already matching the
+// version, like the ones written before an interruption, are not
+// downloaded again. The others are received on up to n concurrent streams.
+// Unless force is set, nothing is changed when a file to replace or
+// remove differs from recorded, the local changes would be lost.
+func fetch(c pb.ImageReposClient, url, ref, root string, recorded *store.Manifest, n int, force bool) (*fetched, error) {
+	result, err := fetchManifest(c, url, ref)
+	if err != nil {
+		return nil, err
+	}
+	r := &receiver{root: root, targets: map[string][]string{}}
+	current := map[string]string{}
+	if recorded != nil {
+		for _, e := range recorded.Entries {
+			current[e.Path] = e.Digest
+		}
+	}
+	var conflicts []string
+	for _, e := range result.manifest.Entries {
+		digest, ok := current[e.Path]
+		delete(current, e.Path)
+		if ok && digest == e.Digest {
+			continue
+		}
+		local, err := localDigest(r.path(e.Path))
+		if err != nil {
+			return nil, err
+		}
+		if local == e.Digest {
+			continue
+		}
+		if local != "" && local != digest {
+			conflicts = append(conflicts, e.Path)
+		}
+		r.targets[e.Digest] = append(r.targets[e.Digest], e.Path)
+		result.updated++
+	}
+	for p, digest := range current {
+		local, err := localDigest(r.path(p))
+		if err != nil {
+			return nil, err
+		}
+		if local != "" && local != digest {
+			conflicts = append(conflicts, p)
+		}
+	}
+	if len(conflicts) > 0 && !force {
+		sort.Strings(conflicts)
+		return nil, &conflictError{paths: conflicts}
+	}
+	metadata := result.metadata
+	fmt.Printf("Version %s: %d file(s), %s\n", metadata.GetDigest(), metadata.GetFileCount(), formatSize(metadata.GetSize()))
+	if len(r.targets) > 0 {
+		r.progress = newProgress("Receiving", r.size(result.manifest), result.updated)
+		// what interrupted downloads left is not received again
+		for digest := range r.targets {
+			if fi, err := os.Stat(r.partial(digest)); err == nil {
+				r.progress.add(fi.Size())
+			}
+		}
+	}
+	// pin the version, the branch may move while we are downloading
+	version := metadata.GetDigest()
+	receivers := r.split(result.manifest, n)
+	errs := make(chan error, len(receivers))
+	var wg sync.WaitGroup
+	for _, r := range receivers {
+		wg.Add(1)
+		go func(r *receiver) {
+			defer wg.Done()
+			errs <- download(c, url, version, r)
+		}(r)
+	}
+	wg.Wait()
+	close(errs)
+	if r.progress != nil {
+		r.progress.finish()
+	}
+	for err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	// what is left was removed in the new version
+	for p := range current {
+		if err = r.remove(p); err != nil {
+			return nil, err
+		}
+		result.removed++
+	}
+	os.Remove(r.path(utils.PartialDir))
+	return result, nil
+}
+
+// localDigest returns the digest of the file at p, empty when there is
+// none.
+func localDigest(p string) (string, error) {
+	digest, _, err := store.HashFile(p)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return digest, err
+}
+
+// conflictError lists the local files an update would overwrite or
+// remove although they were changed.
+type conflictError struct {
+	paths []string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("your local changes to the following files would be lost:\n\t%s\npush them or use --force to discard them",
+		strings.Join(e.paths, "\n\t"))
+}
+
+// download receives the blobs of r, resuming when the stream breaks.
+func download(c pb.ImageReposClient, url, version string, r *receiver) error {
+	for attempt := 1; len(r.targets) > 0; attempt++ {
+		err := receive(c, url, version, r)
+		if err == nil {
+			break
+		}
+		r.abort()
+		if status.Code(err) == codes.OutOfRange {
+			// the kept bytes don't fit the blob, download it again
+			for digest := range r.targets {
+				os.Remove(r.partial(digest))
+			}
+		}
+		if !(retryable(err) || errors.Is(err, errCorrupt)) || attempt == maxAttempts {
+			return err
+		}
+		log.Printf("Download interrupted (%v), resuming", err)
+		backoff(attempt)
+	}
+	if len(r.targets) > 0 {
+		return fmt.Errorf("the server didn't send every file of %s", version)
+	}
+	return nil
+}
+
+// fetchManifest returns the metadata and the manifest of a version.
+func fetchManifest(c pb.ImageReposClient, url, ref string) (*fetched, error) {
+	respStream, err := c.Clone(context.Background(), &pb.CloneRequest{
+		ReposPath:    url,
+		Version:      ref,
+		Files:        true,
+		ManifestOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &fetched{manifest: &store.Manifest{}}
+	for {
+		data, err := respStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch data.GetData().(type) {
+		case *pb.CloneResponse_Metadata:
+			result.metadata = data.GetMetadata()
+		case *pb.CloneResponse_Entry:
+			e := data.GetEntry()
+			result.manifest.Entries = append(result.manifest.Entries, store.Entry{Path: e.GetPath(), Digest: e.GetDigest(), Size: e.GetSize()})
+		}
+	}
+	if result.manifest.Digest() != result.metadata.GetDigest() {
+		return nil, fmt.Errorf("The received manifest doesn't match the version %s", result.metadata.GetDigest())
+	}
+	return result, nil
+}
+
+// receive downloads the blobs r is still missing.
+func receive(c pb.ImageReposClient, url, version string, r *receiver) error {
+	missing, offset := r.missing()
+	respStream, err := c.Clone(context.Background(), &pb.CloneRequest{
+		ReposPath: url,
+		Version:   version,
+		Files:     true,
+		Missing:   missing,
+		Offset:    offset,
+		ChunkSize: int32(transferChunkSize()),
+	})
+	if err != nil {
+		return err
+	}
+	// the stream ends with a trailer telling what was sent
+	h := sha256.New()
+	var size int64
+	var trailer *pb.Trailer
+	for {
+		data, err := respStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch data.GetData().(type) {
+		case *pb.CloneResponse_File:
+			err = r.begin(data.GetFile())
+		case *pb.CloneResponse_Chunk:
+			chunk := data.GetChunk()
+			if err = r.write(chunk); err == nil {
+				h.Write(chunk.GetData())
+				size += int64(len(chunk.GetData()))
+			}
+		case *pb.CloneResponse_Trailer:
+			trailer = data.GetTrailer()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if trailer == nil {
+		return fmt.Errorf("%w: the download ended before its trailer", errCorrupt)
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); trailer.GetSize() != size || trailer.GetDigest() != digest {
+		return fmt.Errorf("%w: received %d bytes with digest %s, %d bytes with digest %s were sent",
+			errCorrupt, size, digest, trailer.GetSize(), trailer.GetDigest())
+	}
+	return r.finish()
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 Fathi BENSARI <fethibensari@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"gopkg.in/yaml.v2"
+)
+
+// uploadSession remembers an unfinished push so the next one resumes the
+// files the server kept instead of sending them again.
+type uploadSession struct {
+	ID     string `yaml:"id"`
+	Digest string `yaml:"digest"`
+}
+
+// openUploadSession returns the session of an interrupted push of the
+// version digest, or starts a new one.
+func openUploadSession(digest string) (*uploadSession, error) {
+	if session := loadUpload(digest); session != nil {
+		return session, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	session := &uploadSession{ID: hex.EncodeToString(b), Digest: digest}
+	content, err := yaml.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	return session, os.WriteFile(utils.UploadFile, content, 0666)
+}
+
+// loadUpload returns the session of an interrupted push of the version
+// digest, nil when there is none.
+func loadUpload(digest string) *uploadSession {
+	content, err := os.ReadFile(utils.UploadFile)
+	if err != nil {
+		return nil
+	}
+	session := &uploadSession{}
+	if yaml.Unmarshal(content, session) != nil {
+		return nil
+	}
+	if session.Digest != digest {
+		// the files changed since, that upload is of no use anymore
+		session.remove()
+		return nil
+	}
+	return session
+}
+
+// remove forgets the session once the version is pushed.
+func (s *uploadSession) remove() {
+	os.Remove(utils.UploadFile)
+}
+
+// uploadOffsets returns how many bytes of each content the server kept
+// from the previous attempts of the upload id.
+func uploadOffsets(c pb.ImageReposClient, id string) (map[string]int64, error) {
+	resp, err := c.QueryUpload(context.Background(), &pb.QueryUploadRequest{UploadId: id})
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[string]int64, len(resp.GetFiles()))
+	for _, f := range resp.GetFiles() {
+		offsets[f.GetDigest()] = f.GetOffset()
+	}
+	return offsets, nil
+}
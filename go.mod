@@ -15,7 +15,7 @@ require (
 	github.com/spf13/viper v1.8.1
 	go.mongodb.org/mongo-driver v1.5.4
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c
 	golang.org/x/text v0.3.6 // indirect
 	google.golang.org/grpc v1.39.0
 	google.golang.org/protobuf v1.27.1
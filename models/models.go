@@ -11,17 +11,47 @@ type User struct {
 }
 
 type Archive struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
+	Username     string              `bson:"username" json:"username"`
+	Hash         uint32              `bson:"hash,omitempty" json:"hash,omitempty"`
+	Digest       string              `bson:"digest" json:"digest"`
+	Manifest     string              `bson:"manifest" json:"manifest"`
+	ZipFile      string              `bson:"zip_file,omitempty" json:"zip_file,omitempty"`
+	FolderName   string              `bson:"folder_name" json:"folder_name"`
+	Size         int64               `bson:"size" json:"size"`
+	FileCount    int                 `bson:"file_count" json:"file_count"`
+	Author       string              `bson:"author,omitempty" json:"author,omitempty"`
+	Message      string              `bson:"message,omitempty" json:"message,omitempty"`
+	Parent       primitive.ObjectID  `bson:"parent,omitempty" json:"parent,omitempty"`
+	ParentDigest string              `bson:"parent_digest,omitempty" json:"parent_digest,omitempty"`
+	Timestamp    primitive.Timestamp `bson:"timestamp" json:"timestamp"`
+}
+
+type Repository struct {
 	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
 	Username   string              `bson:"username" json:"username"`
-	Hash       uint32              `bson:"hash" json:"hash"`
-	ZipFile    string              `bson:"zip_file" json:"zip_file"`
 	FolderName string              `bson:"folder_name" json:"folder_name"`
 	Timestamp  primitive.Timestamp `bson:"timestamp" json:"timestamp"`
 }
 
-type Repository struct {
+type Tag struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
+	Username   string              `bson:"username" json:"username"`
+	FolderName string              `bson:"folder_name" json:"folder_name"`
+	Name       string              `bson:"name" json:"name"`
+	Archive    primitive.ObjectID  `bson:"archive" json:"archive"`
+	Digest     string              `bson:"digest" json:"digest"`
+	Tagger     string              `bson:"tagger" json:"tagger"`
+	Message    string              `bson:"message,omitempty" json:"message,omitempty"`
+	Timestamp  primitive.Timestamp `bson:"timestamp" json:"timestamp"`
+}
+
+type Branch struct {
 	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
 	Username   string              `bson:"username" json:"username"`
 	FolderName string              `bson:"folder_name" json:"folder_name"`
+	Name       string              `bson:"name" json:"name"`
+	Head       primitive.ObjectID  `bson:"head" json:"head"`
+	Digest     string              `bson:"digest" json:"digest"`
 	Timestamp  primitive.Timestamp `bson:"timestamp" json:"timestamp"`
 }
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"image"
+	// register the decoders of the formats we can read dimensions from
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+// Dimensions returns the width and height of the image read from r, both
+// are zero when the format isn't recognised.
+func Dimensions(r io.Reader) (int, int) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// FileDimensions returns the width and height of a local image file.
+func FileDimensions(name string) (int, int) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	return Dimensions(f)
+}
+
+// Dimensions returns the width and height of the image stored as digest.
+func (s *Store) Dimensions(digest string) (int, int) {
+	f, err := s.Open(digest)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	return Dimensions(f)
+}
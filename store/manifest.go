@@ -0,0 +1,199 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Entry is a single file of a repository version.
+type Entry struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest is the tree of a repository version, one entry per file.
+type Manifest struct {
+	Entries []Entry `json:"entries"`
+}
+
+func (m *Manifest) Sort() {
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+}
+
+// Digest returns the version digest of m, the root of a SHA-256 Merkle
+// tree whose leaves hash each file path together with its content digest.
+// Any renamed, added, removed or edited file changes the digest.
+func (m *Manifest) Digest() string {
+	m.Sort()
+	level := make([][]byte, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		h := sha256.New()
+		h.Write([]byte{0})
+		h.Write([]byte(e.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(e.Digest))
+		level = append(level, h.Sum(nil))
+	}
+	if len(level) == 0 {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:])
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// HashFile returns the SHA-256 digest and the size of a local file.
+func HashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Scan hashes the given files, relative to root, into a manifest.
+func Scan(root string, paths []string) (*Manifest, error) {
+	m := &Manifest{}
+	for _, p := range paths {
+		digest, size, err := HashFile(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, Entry{Path: p, Digest: digest, Size: size})
+	}
+	m.Sort()
+	return m, nil
+}
+
+// Changes lists the files that differ between two manifests.
+type Changes struct {
+	Added    []Entry
+	Modified []Entry
+	Removed  []Entry
+	Renamed  []Rename
+}
+
+// Rename is a file moved without being modified.
+type Rename struct {
+	From Entry
+	To   Entry
+}
+
+// DetectRenames pairs removed and added files that share the same content
+// and reports them as renamed instead.
+func (c *Changes) DetectRenames() {
+	removed := make(map[string][]int)
+	for i, e := range c.Removed {
+		removed[e.Digest] = append(removed[e.Digest], i)
+	}
+	gone := make(map[int]bool)
+	var added []Entry
+	for _, e := range c.Added {
+		candidates := removed[e.Digest]
+		if len(candidates) == 0 {
+			added = append(added, e)
+			continue
+		}
+		removed[e.Digest] = candidates[1:]
+		gone[candidates[0]] = true
+		c.Renamed = append(c.Renamed, Rename{From: c.Removed[candidates[0]], To: e})
+	}
+	var left []Entry
+	for i, e := range c.Removed {
+		if !gone[i] {
+			left = append(left, e)
+		}
+	}
+	c.Added, c.Removed = added, left
+}
+
+// Empty reports whether there is no change at all.
+func (c *Changes) Empty() bool {
+	return len(c.Added)+len(c.Modified)+len(c.Removed)+len(c.Renamed) == 0
+}
+
+// Compare returns what has to be applied to from to obtain to.
+func Compare(from, to *Manifest) *Changes {
+	changes := &Changes{}
+	old := make(map[string]Entry, len(from.Entries))
+	for _, e := range from.Entries {
+		old[e.Path] = e
+	}
+	for _, e := range to.Entries {
+		prev, ok := old[e.Path]
+		if !ok {
+			changes.Added = append(changes.Added, e)
+			continue
+		}
+		if prev.Digest != e.Digest {
+			changes.Modified = append(changes.Modified, e)
+		}
+		delete(old, e.Path)
+	}
+	for _, e := range from.Entries {
+		if _, ok := old[e.Path]; ok {
+			changes.Removed = append(changes.Removed, e)
+		}
+	}
+	return changes
+}
+
+// ReadManifest loads a manifest saved with WriteFile.
+func ReadManifest(name string) (*Manifest, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteFile saves the manifest to a local file.
+func (m *Manifest) WriteFile(name string) error {
+	m.Sort()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0666)
+}
+
+// Size returns the total size of the files in bytes.
+func (m *Manifest) Size() int64 {
+	var size int64
+	for _, e := range m.Entries {
+		size += e.Size
+	}
+	return size
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func manifest(entries ...Entry) *Manifest {
+	return &Manifest{Entries: entries}
+}
+
+func TestManifestDigest(t *testing.T) {
+	a := Entry{Path: "a.png", Digest: "aa", Size: 1}
+	b := Entry{Path: "b.png", Digest: "bb", Size: 2}
+	c := Entry{Path: "dir/c.png", Digest: "cc", Size: 3}
+	tests := []struct {
+		name string
+		x, y *Manifest
+		same bool
+	}{
+		{"order of entries", manifest(a, b, c), manifest(c, a, b), true},
+		{"size is not hashed", manifest(a), manifest(Entry{Path: "a.png", Digest: "aa", Size: 9}), true},
+		{"edited file", manifest(a, b), manifest(a, Entry{Path: "b.png", Digest: "b2"}), false},
+		{"renamed file", manifest(a, b), manifest(a, Entry{Path: "c.png", Digest: "bb"}), false},
+		{"added file", manifest(a, b), manifest(a, b, c), false},
+		{"removed file", manifest(a, b, c), manifest(a, c), false},
+		{"path and digest boundary", manifest(Entry{Path: "ab", Digest: "c"}), manifest(Entry{Path: "a", Digest: "bc"}), false},
+		{"empty and one file", manifest(), manifest(a), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.x.Digest() == tt.y.Digest(); same != tt.same {
+				t.Errorf("same digest = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestManifestDigestValue(t *testing.T) {
+	leaf := func(path, digest string) []byte {
+		sum := sha256.Sum256([]byte("\x00" + path + "\x00" + digest))
+		return sum[:]
+	}
+	node := func(l, r []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{1}, l...), r...))
+		return sum[:]
+	}
+	empty := sha256.Sum256(nil)
+	tests := []struct {
+		name string
+		m    *Manifest
+		want []byte
+	}{
+		{"empty", manifest(), empty[:]},
+		{"one file", manifest(Entry{Path: "a", Digest: "1"}), leaf("a", "1")},
+		{"two files", manifest(Entry{Path: "b", Digest: "2"}, Entry{Path: "a", Digest: "1"}),
+			node(leaf("a", "1"), leaf("b", "2"))},
+		// the odd leaf goes up a level unchanged
+		{"three files", manifest(Entry{Path: "a", Digest: "1"}, Entry{Path: "b", Digest: "2"}, Entry{Path: "c", Digest: "3"}),
+			node(node(leaf("a", "1"), leaf("b", "2")), leaf("c", "3"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := tt.m.Digest(), hex.EncodeToString(tt.want); got != want {
+				t.Errorf("Digest() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := Entry{Path: "a.png", Digest: "aa"}
+	b := Entry{Path: "b.png", Digest: "bb"}
+	b2 := Entry{Path: "b.png", Digest: "b2"}
+	c := Entry{Path: "c.png", Digest: "cc"}
+	tests := []struct {
+		name     string
+		from, to *Manifest
+		want     *Changes
+	}{
+		{"identical", manifest(a, b), manifest(b, a), &Changes{}},
+		{"added", manifest(a), manifest(a, c), &Changes{Added: []Entry{c}}},
+		{"removed", manifest(a, c), manifest(a), &Changes{Removed: []Entry{c}}},
+		{"modified", manifest(a, b), manifest(a, b2), &Changes{Modified: []Entry{b2}}},
+		{"everything", manifest(a, b), manifest(b2, c), &Changes{
+			Added:    []Entry{c},
+			Modified: []Entry{b2},
+			Removed:  []Entry{a},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compare() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectRenames(t *testing.T) {
+	a := Entry{Path: "a.png", Digest: "aa"}
+	movedA := Entry{Path: "dir/a.png", Digest: "aa"}
+	b := Entry{Path: "b.png", Digest: "bb"}
+	copyA := Entry{Path: "copy.png", Digest: "aa"}
+	tests := []struct {
+		name    string
+		changes *Changes
+		want    *Changes
+	}{
+		{"nothing to pair",
+			&Changes{Added: []Entry{b}, Removed: []Entry{a}},
+			&Changes{Added: []Entry{b}, Removed: []Entry{a}}},
+		{"moved file",
+			&Changes{Added: []Entry{movedA}, Removed: []Entry{a}},
+			&Changes{Renamed: []Rename{{From: a, To: movedA}}}},
+		{"moved and copied",
+			&Changes{Added: []Entry{movedA, copyA}, Removed: []Entry{a}},
+			&Changes{Added: []Entry{copyA}, Renamed: []Rename{{From: a, To: movedA}}}},
+		{"modified files are left alone",
+			&Changes{Modified: []Entry{b}, Added: []Entry{movedA}, Removed: []Entry{a, b}},
+			&Changes{Modified: []Entry{b}, Removed: []Entry{b}, Renamed: []Rename{{From: a, To: movedA}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.changes.DetectRenames()
+			if !reflect.DeepEqual(tt.changes, tt.want) {
+				t.Errorf("DetectRenames() = %+v, want %+v", tt.changes, tt.want)
+			}
+		})
+	}
+}
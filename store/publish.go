@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Publish makes the directory name serve exactly the files of m. The tree
+// is built next to it in .<name>-<digest> with hard links to the blobs,
+// then name is switched to it with a symlink rename, so readers see
+// either the old or the new version but never a mix of both.
+func (s *Store) Publish(name string, m *Manifest) error {
+	parent, base := filepath.Split(name)
+	snapshot := fmt.Sprintf(".%s-%s", base, m.Digest())
+	if _, err := os.Stat(filepath.Join(parent, snapshot)); os.IsNotExist(err) {
+		if err = s.checkout(parent, snapshot, m); err != nil {
+			return err
+		}
+	}
+	previous, _ := os.Readlink(name)
+	// a symlink can't be renamed over a directory, folders published
+	// before snapshots existed are moved out of the way first
+	if fi, err := os.Lstat(name); err == nil && fi.IsDir() {
+		old, err := os.MkdirTemp(parent, "."+base+"-old-*")
+		if err != nil {
+			return err
+		}
+		if err = os.Rename(name, filepath.Join(old, base)); err != nil {
+			os.Remove(old)
+			return err
+		}
+		defer os.RemoveAll(old)
+	}
+	link := filepath.Join(parent, fmt.Sprintf(".%s-link-%d", base, os.Getpid()))
+	os.Remove(link)
+	if err := os.Symlink(snapshot, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, name); err != nil {
+		os.Remove(link)
+		return err
+	}
+	if previous != "" && previous != snapshot {
+		os.RemoveAll(filepath.Join(parent, previous))
+	}
+	return nil
+}
+
+// Unpublish removes a folder made by Publish and the tree it serves.
+func (s *Store) Unpublish(name string) error {
+	snapshot, err := os.Readlink(name)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(filepath.Dir(name), snapshot))
+}
+
+// checkout writes the files of m into parent/snapshot.
+func (s *Store) checkout(parent, snapshot string, m *Manifest) error {
+	tmp, err := os.MkdirTemp(parent, snapshot+"-tmp-*")
+	if err != nil {
+		return err
+	}
+	for _, e := range m.Entries {
+		if !ValidPath(e.Path) {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("illegal file path: %s", e.Path)
+		}
+		dst := filepath.Join(tmp, filepath.FromSlash(e.Path))
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		if err = s.link(e.Digest, dst); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	if err = os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(parent, snapshot))
+	if os.IsExist(err) {
+		// published concurrently with the same content
+		return os.RemoveAll(tmp)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+	}
+	return err
+}
+
+// link hard links the blob to dst, or copies it when the store lives on
+// another filesystem.
+func (s *Store) link(digest, dst string) error {
+	if err := os.Link(s.Path(digest), dst); err == nil {
+		return nil
+	}
+	src, err := s.Open(digest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
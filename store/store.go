@@ -0,0 +1,214 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store is a content-addressed blob store on the local filesystem.
+// Every blob lives under <root>/<first two hex chars>/<remaining chars>
+// of the SHA-256 of its content, so identical images are stored once no
+// matter how many versions or repositories reference them.
+type Store struct {
+	root string
+}
+
+func New(root string) *Store {
+	return &Store{root: root}
+}
+
+// Path returns the location of the blob with the given digest.
+func (s *Store) Path(digest string) string {
+	return filepath.Join(s.root, digest[:2], digest[2:])
+}
+
+func (s *Store) Has(digest string) bool {
+	if !ValidDigest(digest) {
+		return false
+	}
+	_, err := os.Stat(s.Path(digest))
+	return err == nil
+}
+
+func (s *Store) Open(digest string) (*os.File, error) {
+	if !ValidDigest(digest) {
+		return nil, fmt.Errorf("invalid digest: %q", digest)
+	}
+	return os.Open(s.Path(digest))
+}
+
+// Put copies r into the store and returns its digest and size.
+func (s *Store) Put(r io.Reader) (string, int64, error) {
+	err := os.MkdirAll(s.root, 0755)
+	if err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(s.root, ".tmp-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if s.Has(digest) {
+		return digest, size, nil
+	}
+	dest := s.Path(digest)
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, err
+	}
+	// blobs are shared between versions, they must never be modified in place
+	if err = os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(tmp.Name(), dest); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// PutZip stores every file of the zip archive src and returns the
+// manifest describing it.
+func (s *Store) PutZip(src string) (*Manifest, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	m := &Manifest{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !ValidPath(f.Name) {
+			return nil, fmt.Errorf("illegal file path: %s", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		digest, size, err := s.Put(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, Entry{Path: f.Name, Digest: digest, Size: size})
+	}
+	m.Sort()
+	return m, nil
+}
+
+// Assemble builds the manifest of a version from its entries, every blob
+// must already be in the store. Sizes are taken from the stored blobs.
+func (s *Store) Assemble(entries []Entry) (*Manifest, error) {
+	m := &Manifest{}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !ValidPath(e.Path) {
+			return nil, fmt.Errorf("illegal file path: %s", e.Path)
+		}
+		if seen[e.Path] {
+			return nil, fmt.Errorf("duplicate file path: %s", e.Path)
+		}
+		seen[e.Path] = true
+		if !ValidDigest(e.Digest) {
+			return nil, fmt.Errorf("invalid digest: %q", e.Digest)
+		}
+		fi, err := os.Stat(s.Path(e.Digest))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("the content of %s was not uploaded", e.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, Entry{Path: e.Path, Digest: e.Digest, Size: fi.Size()})
+	}
+	m.Sort()
+	return m, nil
+}
+
+// PutManifest stores the manifest as a blob and returns its digest.
+func (s *Store) PutManifest(m *Manifest) (string, error) {
+	m.Sort()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	digest, _, err := s.Put(bytes.NewReader(data))
+	return digest, err
+}
+
+// Manifest loads the manifest stored under digest.
+func (s *Store) Manifest(digest string) (*Manifest, error) {
+	f, err := s.Open(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := &Manifest{}
+	if err = json.NewDecoder(f).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteZip writes the files listed in m as a zip archive to w.
+func (s *Store) WriteZip(w io.Writer, m *Manifest) error {
+	z := zip.NewWriter(w)
+	for _, e := range m.Entries {
+		src, err := s.Open(e.Digest)
+		if err != nil {
+			return err
+		}
+		dst, err := z.Create(e.Path)
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// ValidDigest reports whether digest is a hex encoded SHA-256.
+func ValidDigest(digest string) bool {
+	if len(digest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// ValidPath reports whether p is a relative slash separated path that
+// stays inside the repository.
+func ValidPath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
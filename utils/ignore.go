@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile lists, gitignore style, the files push leaves out. One can be
+// kept in the repository and another one in the home directory.
+const IgnoreFile = ".imagehubignore"
+
+// defaultIgnores leaves out the files editors and file managers leave
+// next to the images, a "!" pattern in an ignore file brings them back.
+var defaultIgnores = []string{
+	".DS_Store",
+	"._*",
+	"Thumbs.db",
+	"desktop.ini",
+	"*.swp",
+	"*.swo",
+	"*~",
+	".imagehub-*",
+	"imagehub-*.zip",
+}
+
+// Ignore matches paths against gitignore style patterns, the last pattern
+// matching a path decides.
+type Ignore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// LoadIgnore returns the built-in patterns followed by the ones of the
+// global ignore file and of the ignore file of root.
+func LoadIgnore(root string) (*Ignore, error) {
+	ignore := &Ignore{}
+	for _, line := range defaultIgnores {
+		ignore.Add(line)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if err = ignore.AddFile(filepath.Join(home, IgnoreFile)); err != nil {
+			return nil, err
+		}
+	}
+	if err := ignore.AddFile(filepath.Join(root, IgnoreFile)); err != nil {
+		return nil, err
+	}
+	return ignore, nil
+}
+
+// AddFile adds the patterns of an ignore file, a missing file has none.
+func (ig *Ignore) AddFile(name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ig.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Add adds one pattern line, blank lines and comments are skipped.
+func (ig *Ignore) Add(line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// \# and \! match a leading # or !
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// a pattern with a slash is relative to the root, otherwise it
+	// matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return
+	}
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return
+	}
+	p.re = re
+	ig.patterns = append(ig.patterns, p)
+}
+
+// Match reports whether the slash separated path p, relative to the root,
+// is ignored. Files in an ignored folder are ignored too.
+func (ig *Ignore) Match(p string) bool {
+	if dir := path.Dir(p); dir != "." {
+		dirs := strings.Split(dir, "/")
+		for i := range dirs {
+			if ig.match(strings.Join(dirs[:i+1], "/"), true) {
+				return true
+			}
+		}
+	}
+	return ig.match(p, false)
+}
+
+func (ig *Ignore) match(p string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range ig.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.re.MatchString(p) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+// globToRegexp translates a gitignore glob, where ** spans folders.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"a.png", `a\.png`},
+		{"*.png", `[^/]*\.png`},
+		{"img?.png", `img[^/]\.png`},
+		{"**/raw", `(?:.*/)?raw`},
+		{"raw/**", `raw/.*`},
+		{"[abc].png", `[abc]\.png`},
+		{"[!abc].png", `[^abc]\.png`},
+		{"[abc", `\[abc`},
+		{`\*.png`, `\*\.png`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			if got := globToRegexp(tt.glob); got != tt.want {
+				t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"no pattern", nil, "a.png", false},
+		{"name at the root", []string{"*.tmp"}, "a.tmp", true},
+		{"name at any depth", []string{"*.tmp"}, "dir/sub/a.tmp", true},
+		{"star stops at slashes", []string{"dir/*.tmp"}, "dir/sub/a.tmp", false},
+		{"anchored pattern", []string{"/raw"}, "raw", true},
+		{"anchored pattern deeper", []string{"/raw"}, "dir/raw", false},
+		{"double star", []string{"dir/**/a.tmp"}, "dir/x/y/a.tmp", true},
+		{"double star at the start", []string{"**/cache/*.png"}, "cache/a.png", true},
+		{"ignored folder", []string{"raw"}, "raw/a.png", true},
+		{"ignored nested folder", []string{"raw/"}, "dir/raw/a.png", true},
+		{"folder only pattern on a file", []string{"raw/"}, "raw", false},
+		{"negation", []string{"*.png", "!keep.png"}, "keep.png", false},
+		{"last pattern wins", []string{"!keep.png", "*.png"}, "keep.png", true},
+		{"negation doesn't reopen a folder", []string{"raw/", "!raw/a.png"}, "raw/a.png", true},
+		{"comment", []string{"# a.png"}, "# a.png", false},
+		{"escaped hash", []string{`\#a.png`}, "#a.png", true},
+		{"escaped bang", []string{`\!a.png`}, "!a.png", true},
+		{"trailing spaces", []string{"a.png  "}, "a.png", true},
+		{"character class", []string{"img[0-9].png"}, "img7.png", true},
+		{"negated class", []string{"img[!0-9].png"}, "img7.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := &Ignore{}
+			for _, p := range tt.patterns {
+				ig.Add(p)
+			}
+			if got := ig.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) with %q = %v, want %v", tt.path, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIgnore(t *testing.T) {
+	root := t.TempDir()
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", t.TempDir())
+	content := "# drafts\ndrafts/\n!.DS_Store\n"
+	if err := os.WriteFile(filepath.Join(root, IgnoreFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ig, err := LoadIgnore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.png", false},
+		{"a.png.swp", true},
+		{"drafts/a.png", true},
+		{".DS_Store", false},
+		{"imagehub-1234.zip", true},
+	}
+	for _, tt := range tests {
+		if got := ig.Match(tt.path); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package utils
 import (
 	"archive/zip"
 	"fmt"
-	"hash/fnv"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"log"
@@ -17,9 +17,16 @@ import (
 )
 
 type ReposInfo struct {
-	Hash       uint32 `yaml:"hash"`
+	// Hash is the legacy FNV hash written by older clones, Digest replaces it
+	Hash       uint32 `yaml:"hash,omitempty"`
+	Digest     string `yaml:"digest,omitempty"`
 	Owner      string `yaml:"owner"`
 	FolderName string `yaml:"folder_name"`
+	// Branch is empty for clones of the default branch
+	Branch string `yaml:"branch,omitempty"`
+	// Remote is the server the repository was cloned from, a remote name
+	// or an address, empty for the default one
+	Remote string `yaml:"remote,omitempty"`
 }
 
 func (r *ReposInfo) Marshall() ([]byte, error) {
@@ -36,19 +43,57 @@ func (r *ReposInfo) Unmarshall(src string) error {
 }
 
 const (
-	URL           = "http://localhost:5000/"
 	ROOT          = "images"
+	OBJECTS_ROOT  = "objects"
+	ARCHIVE_ROOT  = "archive"
+	UPLOADS_ROOT  = "uploads"
 	HiddenFile    = ".env.yml"
+	ManifestFile  = ".manifest.json"
+	UploadFile    = ".upload.yml"
+	PartialDir    = ".imagehub-partial"
 	MAX_FILE_SIZE = 8 << 20 // 8 MiB
 	ROOT_PP       = "avatar/"
 	MEDIA_ROOT    = "media"
 	MEDIA_URL     = "media/"
 )
 
-func Hash(s string) uint32 {
-	h := fnv.New32a()
-	h.Write([]byte(s))
-	return h.Sum32()
+// ReposPath returns <owner>/<folder>, the path the server knows the
+// repository by.
+func (r *ReposInfo) ReposPath() string {
+	return r.Owner + "/" + r.FolderName
+}
+
+// ValidReposName reports whether name can be an owner or a repository: a
+// single path element that doesn't point at its parent or itself.
+func ValidReposName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// SplitReposPath returns the owner and the folder of a repository path,
+// either <owner>/<folder> or a url ending with them.
+func SplitReposPath(reposPath string) (string, string, bool) {
+	if i := strings.Index(reposPath, "://"); i != -1 {
+		// drop the scheme and the host
+		reposPath = reposPath[i+3:]
+		j := strings.Index(reposPath, "/")
+		if j == -1 {
+			return "", "", false
+		}
+		reposPath = reposPath[j:]
+	}
+	parts := strings.Split(strings.Trim(reposPath, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	owner, folder := parts[len(parts)-2], parts[len(parts)-1]
+	if !ValidReposName(owner) || !ValidReposName(folder) {
+		return "", "", false
+	}
+	// the branches of a repository are published in <folder>@<branch>
+	if strings.Contains(folder, "@") {
+		return "", "", false
+	}
+	return owner, folder, true
 }
 
 func GetRepoFile(name string) string {
@@ -62,7 +107,56 @@ func GetRepoFile(name string) string {
 	return fileList
 }
 
-func CreateFlatZip(w io.Writer, files ...string) error {
+// ListFiles returns the slash separated path, relative to root, of every
+// regular file below root.
+func ListFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// RepoFiles lists the files of the local repository in root, leaving out
+// the metadata imagehub keeps next to them and the ignored files.
+func RepoFiles(root string) ([]string, error) {
+	files, err := ListFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := LoadIgnore(root)
+	if err != nil {
+		return nil, err
+	}
+	var repoFiles []string
+	for _, file := range files {
+		// the metadata is never pushed, whatever the ignore files say
+		if file == HiddenFile || file == ManifestFile || file == UploadFile ||
+			strings.HasPrefix(file, PartialDir+"/") {
+			continue
+		}
+		if ignore.Match(file) {
+			continue
+		}
+		repoFiles = append(repoFiles, file)
+	}
+	return repoFiles, nil
+}
+
+// CreateZip writes the given files into a zip archive, keeping their
+// slash separated path relative to the current directory.
+func CreateZip(w io.Writer, files ...string) error {
 	z := zip.NewWriter(w)
 	for _, file := range files {
 		src, err := os.Open(file)
@@ -77,7 +171,7 @@ func CreateFlatZip(w io.Writer, files ...string) error {
 		if err != nil {
 			return err
 		}
-		hdr.Name = filepath.Base(file) // Write only the base name in the header
+		hdr.Name = filepath.ToSlash(file)
 		dst, err := z.CreateHeader(hdr)
 		if err != nil {
 			return err
@@ -91,6 +185,13 @@ func CreateFlatZip(w io.Writer, files ...string) error {
 	return z.Close()
 }
 
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum returns the CRC-32C carried by every transferred chunk.
+func Checksum(data []byte) uint32 {
+	return crc32.Checksum(data, castagnoli)
+}
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -0,0 +1,33 @@
+package utils
+
+import "testing"
+
+func TestSplitReposPath(t *testing.T) {
+	tests := []struct {
+		path          string
+		owner, folder string
+		ok            bool
+	}{
+		{"alice/cats", "alice", "cats", true},
+		{"/alice/cats/", "alice", "cats", true},
+		{"http://localhost:5000/alice/cats", "alice", "cats", true},
+		{"http://localhost:5000", "", "", false},
+		{"cats", "", "", false},
+		{"alice/", "", "", false},
+		{"alice/.", "", "", false},
+		{"alice/..", "", "", false},
+		{"./cats", "", "", false},
+		{`alice/ca\ts`, "", "", false},
+		{"alice/cats@dev", "", "", false},
+		{"al@ice/cats", "al@ice", "cats", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			owner, folder, ok := SplitReposPath(tt.path)
+			if owner != tt.owner || folder != tt.folder || ok != tt.ok {
+				t.Errorf("SplitReposPath(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.path, owner, folder, ok, tt.owner, tt.folder, tt.ok)
+			}
+		})
+	}
+}
@@ -26,6 +26,17 @@ type ImageReposClient interface {
 	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 	Push(ctx context.Context, opts ...grpc.CallOption) (ImageRepos_PushClient, error)
 	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	Pull(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (ImageRepos_PullClient, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*DiffResponse, error)
+	Tag(ctx context.Context, in *TagRequest, opts ...grpc.CallOption) (*TagResponse, error)
+	ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error)
+	CreateBranch(ctx context.Context, in *CreateBranchRequest, opts ...grpc.CallOption) (*BranchResponse, error)
+	DeleteBranch(ctx context.Context, in *DeleteBranchRequest, opts ...grpc.CallOption) (*BranchResponse, error)
+	ListBranches(ctx context.Context, in *ListBranchesRequest, opts ...grpc.CallOption) (*ListBranchesResponse, error)
+	Revert(ctx context.Context, in *RevertRequest, opts ...grpc.CallOption) (*RevertResponse, error)
+	QueryUpload(ctx context.Context, in *QueryUploadRequest, opts ...grpc.CallOption) (*QueryUploadResponse, error)
+	MissingBlobs(ctx context.Context, in *MissingBlobsRequest, opts ...grpc.CallOption) (*MissingBlobsResponse, error)
 }
 
 type imageReposClient struct {
@@ -120,6 +131,128 @@ func (c *imageReposClient) Check(ctx context.Context, in *CheckRequest, opts ...
 	return out, nil
 }
 
+func (c *imageReposClient) Pull(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (ImageRepos_PullClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ImageRepos_ServiceDesc.Streams[2], "/imagehub.imageRepos/Pull", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &imageReposPullClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ImageRepos_PullClient interface {
+	Recv() (*PullResponse, error)
+	grpc.ClientStream
+}
+
+type imageReposPullClient struct {
+	grpc.ClientStream
+}
+
+func (x *imageReposPullClient) Recv() (*PullResponse, error) {
+	m := new(PullResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *imageReposClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/History", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*DiffResponse, error) {
+	out := new(DiffResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/Diff", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) Tag(ctx context.Context, in *TagRequest, opts ...grpc.CallOption) (*TagResponse, error) {
+	out := new(TagResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/Tag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error) {
+	out := new(ListTagsResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/ListTags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) CreateBranch(ctx context.Context, in *CreateBranchRequest, opts ...grpc.CallOption) (*BranchResponse, error) {
+	out := new(BranchResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/CreateBranch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) DeleteBranch(ctx context.Context, in *DeleteBranchRequest, opts ...grpc.CallOption) (*BranchResponse, error) {
+	out := new(BranchResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/DeleteBranch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) ListBranches(ctx context.Context, in *ListBranchesRequest, opts ...grpc.CallOption) (*ListBranchesResponse, error) {
+	out := new(ListBranchesResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/ListBranches", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) Revert(ctx context.Context, in *RevertRequest, opts ...grpc.CallOption) (*RevertResponse, error) {
+	out := new(RevertResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/Revert", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) QueryUpload(ctx context.Context, in *QueryUploadRequest, opts ...grpc.CallOption) (*QueryUploadResponse, error) {
+	out := new(QueryUploadResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/QueryUpload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageReposClient) MissingBlobs(ctx context.Context, in *MissingBlobsRequest, opts ...grpc.CallOption) (*MissingBlobsResponse, error) {
+	out := new(MissingBlobsResponse)
+	err := c.cc.Invoke(ctx, "/imagehub.imageRepos/MissingBlobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ImageReposServer is the server API for ImageRepos service.
 // All implementations must embed UnimplementedImageReposServer
 // for forward compatibility
@@ -128,6 +261,17 @@ type ImageReposServer interface {
 	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
 	Push(ImageRepos_PushServer) error
 	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	Pull(*PullRequest, ImageRepos_PullServer) error
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	Diff(context.Context, *DiffRequest) (*DiffResponse, error)
+	Tag(context.Context, *TagRequest) (*TagResponse, error)
+	ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error)
+	CreateBranch(context.Context, *CreateBranchRequest) (*BranchResponse, error)
+	DeleteBranch(context.Context, *DeleteBranchRequest) (*BranchResponse, error)
+	ListBranches(context.Context, *ListBranchesRequest) (*ListBranchesResponse, error)
+	Revert(context.Context, *RevertRequest) (*RevertResponse, error)
+	QueryUpload(context.Context, *QueryUploadRequest) (*QueryUploadResponse, error)
+	MissingBlobs(context.Context, *MissingBlobsRequest) (*MissingBlobsResponse, error)
 	mustEmbedUnimplementedImageReposServer()
 }
 
@@ -147,6 +291,39 @@ func (UnimplementedImageReposServer) Push(ImageRepos_PushServer) error {
 func (UnimplementedImageReposServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
 }
+func (UnimplementedImageReposServer) Pull(*PullRequest, ImageRepos_PullServer) error {
+	return status.Errorf(codes.Unimplemented, "method Pull not implemented")
+}
+func (UnimplementedImageReposServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedImageReposServer) Diff(context.Context, *DiffRequest) (*DiffResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Diff not implemented")
+}
+func (UnimplementedImageReposServer) Tag(context.Context, *TagRequest) (*TagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Tag not implemented")
+}
+func (UnimplementedImageReposServer) ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTags not implemented")
+}
+func (UnimplementedImageReposServer) CreateBranch(context.Context, *CreateBranchRequest) (*BranchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBranch not implemented")
+}
+func (UnimplementedImageReposServer) DeleteBranch(context.Context, *DeleteBranchRequest) (*BranchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBranch not implemented")
+}
+func (UnimplementedImageReposServer) ListBranches(context.Context, *ListBranchesRequest) (*ListBranchesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBranches not implemented")
+}
+func (UnimplementedImageReposServer) Revert(context.Context, *RevertRequest) (*RevertResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revert not implemented")
+}
+func (UnimplementedImageReposServer) QueryUpload(context.Context, *QueryUploadRequest) (*QueryUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryUpload not implemented")
+}
+func (UnimplementedImageReposServer) MissingBlobs(context.Context, *MissingBlobsRequest) (*MissingBlobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MissingBlobs not implemented")
+}
 func (UnimplementedImageReposServer) mustEmbedUnimplementedImageReposServer() {}
 
 // UnsafeImageReposServer may be embedded to opt out of forward compatibility for this service.
@@ -243,6 +420,207 @@ func _ImageRepos_Check_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ImageRepos_Pull_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PullRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageReposServer).Pull(m, &imageReposPullServer{stream})
+}
+
+type ImageRepos_PullServer interface {
+	Send(*PullResponse) error
+	grpc.ServerStream
+}
+
+type imageReposPullServer struct {
+	grpc.ServerStream
+}
+
+func (x *imageReposPullServer) Send(m *PullResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ImageRepos_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/History",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_Diff_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiffRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).Diff(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/Diff",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).Diff(ctx, req.(*DiffRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_Tag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).Tag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/Tag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).Tag(ctx, req.(*TagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_ListTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).ListTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/ListTags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).ListTags(ctx, req.(*ListTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_CreateBranch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBranchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).CreateBranch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/CreateBranch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).CreateBranch(ctx, req.(*CreateBranchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_DeleteBranch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBranchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).DeleteBranch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/DeleteBranch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).DeleteBranch(ctx, req.(*DeleteBranchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_ListBranches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBranchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).ListBranches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/ListBranches",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).ListBranches(ctx, req.(*ListBranchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_Revert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevertRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).Revert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/Revert",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).Revert(ctx, req.(*RevertRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_QueryUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).QueryUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/QueryUpload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).QueryUpload(ctx, req.(*QueryUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageRepos_MissingBlobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MissingBlobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageReposServer).MissingBlobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/imagehub.imageRepos/MissingBlobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageReposServer).MissingBlobs(ctx, req.(*MissingBlobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ImageRepos_ServiceDesc is the grpc.ServiceDesc for ImageRepos service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -258,6 +636,46 @@ var ImageRepos_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Check",
 			Handler:    _ImageRepos_Check_Handler,
 		},
+		{
+			MethodName: "History",
+			Handler:    _ImageRepos_History_Handler,
+		},
+		{
+			MethodName: "Diff",
+			Handler:    _ImageRepos_Diff_Handler,
+		},
+		{
+			MethodName: "Tag",
+			Handler:    _ImageRepos_Tag_Handler,
+		},
+		{
+			MethodName: "ListTags",
+			Handler:    _ImageRepos_ListTags_Handler,
+		},
+		{
+			MethodName: "CreateBranch",
+			Handler:    _ImageRepos_CreateBranch_Handler,
+		},
+		{
+			MethodName: "DeleteBranch",
+			Handler:    _ImageRepos_DeleteBranch_Handler,
+		},
+		{
+			MethodName: "ListBranches",
+			Handler:    _ImageRepos_ListBranches_Handler,
+		},
+		{
+			MethodName: "Revert",
+			Handler:    _ImageRepos_Revert_Handler,
+		},
+		{
+			MethodName: "QueryUpload",
+			Handler:    _ImageRepos_QueryUpload_Handler,
+		},
+		{
+			MethodName: "MissingBlobs",
+			Handler:    _ImageRepos_MissingBlobs_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -270,6 +688,11 @@ var ImageRepos_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ImageRepos_Push_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Pull",
+			Handler:       _ImageRepos_Pull_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "v1/pb/imagehub.proto",
 }
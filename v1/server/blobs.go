@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MissingBlobs tells a client about to push which of its files the server
+// doesn't have, only those need to be uploaded.
+func (s *Server) MissingBlobs(ctx context.Context, req *pb.MissingBlobsRequest) (*pb.MissingBlobsResponse, error) {
+	// the answer reveals what is stored, only users can ask
+	if _, err := authenticate(ctx, req.GetUsername(), req.GetPassword()); err != nil {
+		return nil, err
+	}
+	resp := &pb.MissingBlobsResponse{}
+	seen := make(map[string]bool, len(req.GetDigests()))
+	for _, digest := range req.GetDigests() {
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+		if !Blobs.Has(digest) {
+			resp.Missing = append(resp.Missing, digest)
+		}
+	}
+	return resp, nil
+}
+
+// receiveBlobs stores the files of a blobs upload as they arrive, each one
+// checked against its header, and returns them with the entries listed by
+// the push. What was stored before the connection dropped stays, the
+// client doesn't send it again and resumes the files cut short.
+func receiveBlobs(stream pb.ImageRepos_PushServer, u *blobUpload) (*store.Manifest, []*pb.FileHeader, error) {
+	manifest := &store.Manifest{}
+	var entries []*pb.FileHeader
+	h := sha256.New()
+	var size int64
+	var trailer *pb.Trailer
+	var b *blobWriter
+	defer func() {
+		if b != nil {
+			b.abort()
+		}
+	}()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the client canceled or the connection dropped
+			return nil, nil, err
+		}
+		switch data := req.GetData().(type) {
+		case *pb.PushRequest_File:
+			if b != nil {
+				err = b.close(manifest)
+				b = nil
+			}
+			if err == nil {
+				b, err = newBlobWriter(u, data.File)
+			}
+		case *pb.PushRequest_Chunk:
+			if b == nil {
+				return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Received data before any file header"))
+			}
+			if err = b.write(data.Chunk); err == nil {
+				h.Write(data.Chunk.GetData())
+				size += int64(len(data.Chunk.GetData()))
+			}
+		case *pb.PushRequest_Entry:
+			entries = append(entries, data.Entry)
+		case *pb.PushRequest_Trailer:
+			trailer = data.Trailer
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if trailer == nil {
+		return nil, nil, status.Error(codes.Aborted, fmt.Sprintf("The upload ended before its trailer, push again"))
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); trailer.GetSize() != size || trailer.GetDigest() != digest {
+		return nil, nil, status.Error(codes.DataLoss,
+			fmt.Sprintf("The upload is corrupted: got %d bytes with digest %s, expected %d bytes with digest %s",
+				size, digest, trailer.GetSize(), trailer.GetDigest()))
+	}
+	if b != nil {
+		err := b.close(manifest)
+		b = nil
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	manifest.Sort()
+	return manifest, entries, nil
+}
+
+// blobUpload is the session of a blobs push. Files that didn't fully
+// arrive are kept in uploads/<id>/<digest>, a push with the same id
+// resumes each of them where it stopped.
+type blobUpload struct {
+	id  string
+	dir string
+	// sessions without a client chosen id can't be resumed
+	resumable bool
+}
+
+// openBlobUpload starts or resumes the blobs session id of the push
+// described by info. The parallel streams of a push share it.
+func openBlobUpload(id string, info uploadInfo) (*blobUpload, error) {
+	resumable := id != ""
+	if !resumable {
+		var err error
+		if id, err = newUploadID(); err != nil {
+			return nil, err
+		}
+	}
+	if !validUploadID(id) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid upload id %q", id))
+	}
+	u := &blobUpload{id: id, dir: filepath.Join(utils.UPLOADS_ROOT, id), resumable: resumable}
+	if err := bindUpload(u.dir, id, info); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// close drops the session once the push creating the version is done
+// with it, or right away when it can't be resumed.
+func (u *blobUpload) close(done bool) {
+	if done || !u.resumable {
+		os.RemoveAll(u.dir)
+	}
+}
+
+func (u *blobUpload) partial(digest string) string {
+	return filepath.Join(u.dir, digest)
+}
+
+// blobWriter receives one file of a blobs upload in its session, then
+// moves it into the blob store.
+type blobWriter struct {
+	upload  *blobUpload
+	header  *pb.FileHeader
+	key     string
+	f       *os.File
+	written int64
+}
+
+func newBlobWriter(u *blobUpload, header *pb.FileHeader) (*blobWriter, error) {
+	if !store.ValidPath(header.GetPath()) || !store.ValidDigest(header.GetDigest()) {
+		return nil, status.Error(codes.InvalidArgument,
+			fmt.Sprintf("Invalid file %q with digest %q", header.GetPath(), header.GetDigest()))
+	}
+	if header.GetOffset() < 0 || header.GetOffset() > header.GetSize() {
+		return nil, status.Error(codes.InvalidArgument,
+			fmt.Sprintf("Invalid offset %d for %s of %d bytes", header.GetOffset(), header.GetPath(), header.GetSize()))
+	}
+	key := u.id + "/" + header.GetDigest()
+	uploadsMu.Lock()
+	if activeUploads[key] {
+		uploadsMu.Unlock()
+		return nil, status.Error(codes.Aborted, fmt.Sprintf("%s is already being uploaded", header.GetPath()))
+	}
+	activeUploads[key] = true
+	uploadsMu.Unlock()
+	b := &blobWriter{upload: u, header: header, key: key}
+	if err := b.open(); err != nil {
+		b.release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// open starts the file, or resumes it at the offset of its header which
+// must be what was kept.
+func (b *blobWriter) open() error {
+	flag := os.O_CREATE | os.O_RDWR
+	if b.header.GetOffset() == 0 {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(b.upload.partial(b.header.GetDigest()), flag, 0644)
+	if err != nil {
+		return internalError("Cannot open %s in the upload %s: %v", b.header.GetDigest(), b.upload.id, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return internalError("Cannot open %s in the upload %s: %v", b.header.GetDigest(), b.upload.id, err)
+	}
+	if fi.Size() != b.header.GetOffset() {
+		f.Close()
+		return status.Error(codes.OutOfRange,
+			fmt.Sprintf("%s is at offset %d, got a resume at %d", b.header.GetPath(), fi.Size(), b.header.GetOffset()))
+	}
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return internalError("Cannot open %s in the upload %s: %v", b.header.GetDigest(), b.upload.id, err)
+	}
+	b.f = f
+	b.written = fi.Size()
+	return nil
+}
+
+// write adds a chunk once its checksum and position are checked.
+func (b *blobWriter) write(chunk *pb.Chunk) error {
+	if utils.Checksum(chunk.GetData()) != chunk.GetChecksum() {
+		return status.Error(codes.Aborted,
+			fmt.Sprintf("The chunk at offset %d of %s is corrupted", chunk.GetOffset(), b.header.GetPath()))
+	}
+	if chunk.GetOffset() != b.written {
+		return status.Error(codes.OutOfRange,
+			fmt.Sprintf("%s is at offset %d, got a chunk for %d", b.header.GetPath(), b.written, chunk.GetOffset()))
+	}
+	if b.written+int64(len(chunk.GetData())) > b.header.GetSize() {
+		return status.Error(codes.OutOfRange, fmt.Sprintf("%s is larger than announced", b.header.GetPath()))
+	}
+	n, err := b.f.Write(chunk.GetData())
+	b.written += int64(n)
+	if err != nil {
+		return internalError("Cannot write %s in the upload %s: %v", b.header.GetDigest(), b.upload.id, err)
+	}
+	return nil
+}
+
+// close stores the complete file and adds it to manifest.
+func (b *blobWriter) close(manifest *store.Manifest) error {
+	defer b.release()
+	if b.written != b.header.GetSize() {
+		b.f.Close()
+		return status.Error(codes.Aborted,
+			fmt.Sprintf("%s stopped at %d of %d bytes, push again to resume", b.header.GetPath(), b.written, b.header.GetSize()))
+	}
+	_, err := b.f.Seek(0, io.SeekStart)
+	var digest string
+	var size int64
+	if err == nil {
+		digest, size, err = Blobs.Put(b.f)
+	}
+	b.f.Close()
+	if err != nil {
+		return internalError("Cannot store %s: %v", b.header.GetDigest(), err)
+	}
+	os.Remove(b.upload.partial(b.header.GetDigest()))
+	// content is addressed by its digest, a damaged file is stored under
+	// another one and never used
+	if digest != b.header.GetDigest() || size != b.header.GetSize() {
+		return status.Error(codes.DataLoss,
+			fmt.Sprintf("%s doesn't match its digest %s", b.header.GetPath(), b.header.GetDigest()))
+	}
+	manifest.Entries = append(manifest.Entries, store.Entry{Path: b.header.GetPath(), Digest: digest, Size: size})
+	return nil
+}
+
+// abort keeps what arrived of a file, a later push resumes it.
+func (b *blobWriter) abort() {
+	b.f.Sync()
+	b.f.Close()
+	b.release()
+}
+
+func (b *blobWriter) release() {
+	uploadsMu.Lock()
+	delete(activeUploads, b.key)
+	uploadsMu.Unlock()
+}
+
+func toEntries(headers []*pb.FileHeader) []store.Entry {
+	entries := make([]store.Entry, 0, len(headers))
+	for _, h := range headers {
+		entries = append(entries, store.Entry{Path: h.GetPath(), Digest: h.GetDigest(), Size: h.GetSize()})
+	}
+	return entries
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) CreateBranch(ctx context.Context, req *pb.CreateBranchRequest) (*pb.BranchResponse, error) {
+	if err := authorize(ctx, req.GetUsername(), req.GetPassword(), req.GetOwner(), req.GetFolderName()); err != nil {
+		return nil, err
+	}
+	archive, err := Versions.Resolve(ctx, req.GetOwner(), req.GetFolderName(), req.GetVersion())
+	if err != nil {
+		return nil, versionError(err, req.GetVersion())
+	}
+	branch, err := Versions.CreateBranch(ctx, archive, req.GetName())
+	switch err {
+	case nil:
+	case versions.ErrInvalidName:
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid branch name %q", req.GetName()))
+	case versions.ErrBranchExists:
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("The branch %s already exists", req.GetName()))
+	case versions.ErrNameTaken:
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("%s is already the name of a tag", req.GetName()))
+	default:
+		log.Printf("Cannot create the branch %s of %s/%s: %v", req.GetName(), req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	err = Versions.PublishHead(ctx, utils.ROOT, req.GetOwner(), req.GetFolderName(), branch.Name)
+	if err != nil {
+		// the branch is usable, only the web interface won't show it yet
+		log.Printf("Cannot publish the branch %s of %s/%s: %v", branch.Name, req.GetOwner(), req.GetFolderName(), err)
+	}
+	return &pb.BranchResponse{Branch: branchInfo(branch)}, nil
+}
+
+func (s *Server) DeleteBranch(ctx context.Context, req *pb.DeleteBranchRequest) (*pb.BranchResponse, error) {
+	if err := authorize(ctx, req.GetUsername(), req.GetPassword(), req.GetOwner(), req.GetFolderName()); err != nil {
+		return nil, err
+	}
+	branch, err := Versions.DeleteBranch(ctx, req.GetOwner(), req.GetFolderName(), req.GetName())
+	switch err {
+	case nil:
+	case versions.ErrDefaultBranch:
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("The branch %s can't be deleted", versions.DefaultBranch))
+	case versions.ErrNotFound:
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Cannot find the branch %s", req.GetName()))
+	default:
+		log.Printf("Cannot delete the branch %s of %s/%s: %v", req.GetName(), req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	err = Versions.Unpublish(utils.ROOT, req.GetOwner(), req.GetFolderName(), branch.Name)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Cannot unpublish the branch %s of %s/%s: %v", branch.Name, req.GetOwner(), req.GetFolderName(), err)
+	}
+	return &pb.BranchResponse{Branch: branchInfo(branch)}, nil
+}
+
+func (s *Server) ListBranches(ctx context.Context, req *pb.ListBranchesRequest) (*pb.ListBranchesResponse, error) {
+	branches, err := Versions.Branches(ctx, req.GetOwner(), req.GetFolderName())
+	if err != nil {
+		log.Printf("Cannot list the branches of %s/%s: %v", req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	resp := &pb.ListBranchesResponse{}
+	for _, branch := range branches {
+		resp.Branches = append(resp.Branches, branchInfo(branch))
+	}
+	return resp, nil
+}
+
+func branchInfo(branch *models.Branch) *pb.Branch {
+	return &pb.Branch{
+		Name:      branch.Name,
+		Digest:    branch.Digest,
+		Timestamp: int64(branch.Timestamp.T),
+	}
+}
+
+// authorize checks the credentials belong to the owner of the repository.
+func authorize(ctx context.Context, username, password, owner, folder string) error {
+	user, err := authenticate(ctx, username, password)
+	if err != nil {
+		return err
+	}
+	if user.Username != owner {
+		return status.Error(codes.PermissionDenied,
+			fmt.Sprintf("Only %s can change %s/%s", owner, owner, folder))
+	}
+	return nil
+}
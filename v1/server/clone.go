@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sendFiles streams the manifest of a version then the blobs the client
+// is missing, so an interrupted clone only asks for what it doesn't have.
+func sendFiles(req *pb.CloneRequest, stream pb.ImageRepos_CloneServer, manifest *store.Manifest) error {
+	byDigest := make(map[string]store.Entry, len(manifest.Entries))
+	for _, e := range manifest.Entries {
+		err := stream.Send(&pb.CloneResponse{
+			Data: &pb.CloneResponse_Entry{
+				Entry: &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, ok := byDigest[e.Digest]; !ok {
+			byDigest[e.Digest] = e
+		}
+	}
+	if req.GetManifestOnly() {
+		return nil
+	}
+	// the client copies a blob to every path using it, each is sent once
+	missing := req.GetMissing()
+	if len(missing) == 0 {
+		for _, e := range manifest.Entries {
+			missing = append(missing, e.Digest)
+		}
+	}
+	offset := req.GetOffset()
+	h := sha256.New()
+	var size int64
+	sent := make(map[string]bool, len(missing))
+	for _, digest := range missing {
+		e, ok := byDigest[digest]
+		if !ok {
+			return status.Error(codes.InvalidArgument,
+				fmt.Sprintf("The blob %s is not part of this version", digest))
+		}
+		if sent[digest] {
+			continue
+		}
+		sent[digest] = true
+		if offset < 0 || offset > e.Size {
+			return status.Error(codes.OutOfRange, fmt.Sprintf("Invalid offset %d for %s", offset, digest))
+		}
+		err := stream.Send(&pb.CloneResponse{
+			Data: &pb.CloneResponse_File{
+				File: &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size, Offset: offset},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		err = sendBlob(e.Digest, offset, chunkSize(req.GetChunkSize()), func(data []byte) error {
+			h.Write(data)
+			err := stream.Send(&pb.CloneResponse{
+				Data: &pb.CloneResponse_Chunk{
+					Chunk: &pb.Chunk{Offset: offset, Data: data, Checksum: utils.Checksum(data)},
+				},
+			})
+			offset += int64(len(data))
+			size += int64(len(data))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// the offset only applies to the first blob
+		offset = 0
+	}
+	// the client checks it received everything that was sent
+	return stream.Send(&pb.CloneResponse{
+		Data: &pb.CloneResponse_Trailer{
+			Trailer: &pb.Trailer{Size: size, Digest: hex.EncodeToString(h.Sum(nil))},
+		},
+	})
+}
+
+const (
+	// defaultChunkSize is the data sent per message when the client
+	// doesn't choose, maxChunkSize keeps messages under the gRPC limit
+	defaultChunkSize = 64 << 10
+	maxChunkSize     = 1 << 20
+)
+
+// chunkSize returns the chunk size asked by a client, within the limits.
+func chunkSize(asked int32) int {
+	switch {
+	case asked <= 0:
+		return defaultChunkSize
+	case asked < 4<<10:
+		return 4 << 10
+	case asked > maxChunkSize:
+		return maxChunkSize
+	}
+	return int(asked)
+}
+
+// sendBlob reads a blob from the store, starting at offset, and hands it
+// to send chunk by chunk.
+func sendBlob(digest string, offset int64, chunkSize int, send func(chunk []byte) error) error {
+	f, err := Blobs.Open(digest)
+	if err != nil {
+		log.Printf("Cannot open blob %s: %v", digest, err)
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	r := bufio.NewReader(f)
+	buffer := make([]byte, 0, chunkSize)
+	for {
+		n, err := r.Read(buffer[:cap(buffer)])
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+		}
+		if err = send(buffer[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
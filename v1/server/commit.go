@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// commit makes a verified version visible: it creates the repository if
+// needed, records the archive, moves the branch and publishes the files.
+// Mongo runs standalone without transactions, so each step that succeeded
+// is undone when a later one fails or the client goes away.
+func commit(ctx context.Context, archive *models.Archive, branch string, head *models.Archive) (err error) {
+	var undo []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}()
+	owner, folder := archive.Username, archive.FolderName
+	// create the repository on its first push
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+	}
+	count, err := RepositoryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return internalError("Cannot find the repository %s/%s: %v", owner, folder, err)
+	}
+	if count == 0 {
+		newRepos := &models.Repository{
+			Username:   owner,
+			FolderName: folder,
+			Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
+		}
+		resp, err := RepositoryCollection.InsertOne(ctx, newRepos)
+		if err != nil {
+			return internalError("Cannot create the repository %s/%s: %v", owner, folder, err)
+		}
+		undo = append(undo, func() {
+			RepositoryCollection.DeleteOne(context.Background(), bson.M{"_id": resp.InsertedID})
+		})
+	}
+	// another push may have landed on the branch while this one was uploading
+	err = Versions.Record(ctx, archive, branch, head)
+	if err == versions.ErrStale {
+		base, current := "", ""
+		if head != nil {
+			base = head.Digest
+		}
+		if head, err := Versions.Head(ctx, owner, folder, branch); err == nil {
+			current = head.Digest
+		}
+		return staleError(base, current)
+	}
+	if err != nil {
+		return internalError("Cannot record the version %s of %s/%s: %v", archive.Digest, owner, folder, err)
+	}
+	undo = append(undo, func() {
+		if err := Versions.Unrecord(context.Background(), archive, branch, head); err != nil {
+			log.Printf("Cannot undo the version %s of %s/%s: %v", archive.Digest, owner, folder, err)
+		}
+	})
+	if err = ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	// serve exactly the pushed files, removed images disappear too
+	err = Versions.PublishHead(ctx, utils.ROOT, owner, folder, branch)
+	if err != nil {
+		return internalError("Cannot publish %s/%s: %v", owner, folder, err)
+	}
+	return nil
+}
+
+// internalError logs the cause and hides it from the client.
+func internalError(format string, v ...interface{}) error {
+	log.Printf(format, v...)
+	return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var changeKinds = map[string]pb.ChangeKind{
+	versions.Added:    pb.ChangeKind_Added,
+	versions.Removed:  pb.ChangeKind_Removed,
+	versions.Modified: pb.ChangeKind_Modified,
+	versions.Renamed:  pb.ChangeKind_Renamed,
+}
+
+func (s *Server) Diff(ctx context.Context, req *pb.DiffRequest) (*pb.DiffResponse, error) {
+	from, err := Versions.Resolve(ctx, req.GetOwner(), req.GetFolderName(), req.GetFrom())
+	if err != nil {
+		return nil, versionError(err, req.GetFrom())
+	}
+	to, err := Versions.Resolve(ctx, req.GetOwner(), req.GetFolderName(), req.GetTo())
+	if err != nil {
+		return nil, versionError(err, req.GetTo())
+	}
+	diff, err := Versions.Diff(ctx, from, to)
+	if err != nil {
+		log.Printf("Cannot compare %s and %s: %v", from.Digest, to.Digest, err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	resp := &pb.DiffResponse{
+		From: diff.From.Digest,
+		To:   diff.To.Digest,
+	}
+	for _, change := range diff.Changes {
+		resp.Changes = append(resp.Changes, &pb.FileChange{
+			Kind:   changeKinds[change.Kind],
+			Before: fileInfo(change.Before),
+			After:  fileInfo(change.After),
+		})
+	}
+	return resp, nil
+}
+
+func fileInfo(info *versions.FileInfo) *pb.FileInfo {
+	if info == nil {
+		return nil
+	}
+	return &pb.FileInfo{
+		Path:   info.Path,
+		Digest: info.Digest,
+		Size:   info.Size,
+		Width:  int32(info.Width),
+		Height: int32(info.Height),
+	}
+}
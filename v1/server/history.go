@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) History(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	archives, err := Versions.History(ctx, req.GetOwner(), req.GetFolderName(), req.GetBranch())
+	if err != nil {
+		log.Printf("Cannot list the versions of %s/%s: %v", req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	if len(archives) == 0 && req.GetBranch() != "" {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Cannot find the branch %s", req.GetBranch()))
+	}
+	if len(archives) == 0 {
+		return nil, status.Errorf(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find image repos %s/%s", req.GetOwner(), req.GetFolderName()),
+		)
+	}
+	resp := &pb.HistoryResponse{}
+	for _, archive := range archives {
+		resp.Versions = append(resp.Versions, versionInfo(archive))
+	}
+	return resp, nil
+}
+
+func versionInfo(archive *models.Archive) *pb.Version {
+	author := archive.Author
+	if author == "" {
+		// only the owner could push before authors were recorded
+		author = archive.Username
+	}
+	return &pb.Version{
+		Digest:    archive.Digest,
+		Author:    author,
+		Timestamp: int64(archive.Timestamp.T),
+		Size:      archive.Size,
+		FileCount: int32(archive.FileCount),
+		Message:   archive.Message,
+		Parent:    archive.ParentDigest,
+	}
+}
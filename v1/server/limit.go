@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxStreamsPerUser caps the transfers a user runs at the same time, so
+// one parallel client can't take every connection of the server.
+const maxStreamsPerUser = 8
+
+var (
+	streamsMu sync.Mutex
+	streams   = map[string]int{}
+)
+
+// acquireStream reserves a transfer slot for key, the returned function
+// gives it back.
+func acquireStream(key string) (func(), error) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	if streams[key] >= maxStreamsPerUser {
+		// Unavailable tells clients to retry, unlike a message too large
+		return nil, status.Error(codes.Unavailable,
+			fmt.Sprintf("Too many transfers in progress for %s, at most %d at a time", key, maxStreamsPerUser))
+	}
+	streams[key]++
+	return func() {
+		streamsMu.Lock()
+		defer streamsMu.Unlock()
+		if streams[key]--; streams[key] == 0 {
+			delete(streams, key)
+		}
+	}, nil
+}
+
+// clientAddress identifies the anonymous client of a stream by its host.
+func clientAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
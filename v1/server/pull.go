@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Pull(req *pb.PullRequest, stream pb.ImageRepos_PullServer) error {
+	ctx := stream.Context()
+	release, err := acquireStream(clientAddress(ctx))
+	if err != nil {
+		return err
+	}
+	defer release()
+	metadata := req.GetMetadata()
+	// find the version the client has and the one it moves to
+	current, err := findVersion(ctx, metadata)
+	if err == mongo.ErrNoDocuments {
+		return status.Error(codes.NotFound,
+			fmt.Sprintf("The provided version is invalid %s", versionName(metadata)))
+	}
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	target, err := Versions.Resolve(ctx, metadata.GetOwner(), metadata.GetFolderName(), req.GetTarget())
+	if err != nil {
+		return versionError(err, req.GetTarget())
+	}
+	from, err := Versions.Manifest(ctx, current)
+	if err != nil {
+		log.Printf("Cannot load the manifest of %s: %v", current.Digest, err)
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	to, err := Versions.Manifest(ctx, target)
+	if err != nil {
+		log.Printf("Cannot load the manifest of %s: %v", target.Digest, err)
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	err = stream.Send(&pb.PullResponse{
+		Data: &pb.PullResponse_Metadata{
+			Metadata: &pb.MetaData{
+				Digest:     target.Digest,
+				Owner:      target.Username,
+				FolderName: target.FolderName,
+				Size:       to.Size(),
+				FileCount:  int32(len(to.Entries)),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// the client keeps the manifest to detect its local changes
+	for _, e := range to.Entries {
+		err = stream.Send(&pb.PullResponse{
+			Data: &pb.PullResponse_Entry{
+				Entry: &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// send only what changed between the two versions
+	changes := store.Compare(from, to)
+	h := sha256.New()
+	var size int64
+	for _, e := range changes.Removed {
+		err = stream.Send(&pb.PullResponse{
+			Data: &pb.PullResponse_Removed{Removed: e.Path},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range append(changes.Added, changes.Modified...) {
+		err = stream.Send(&pb.PullResponse{
+			Data: &pb.PullResponse_File{
+				File: &pb.FileHeader{Path: e.Path, Digest: e.Digest, Size: e.Size},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		var offset int64
+		err = sendBlob(e.Digest, 0, defaultChunkSize, func(data []byte) error {
+			h.Write(data)
+			err := stream.Send(&pb.PullResponse{
+				Data: &pb.PullResponse_Chunk{
+					Chunk: &pb.Chunk{Offset: offset, Data: data, Checksum: utils.Checksum(data)},
+				},
+			})
+			offset += int64(len(data))
+			size += int64(len(data))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// the client checks it received everything that was sent
+	return stream.Send(&pb.PullResponse{
+		Data: &pb.PullResponse_Trailer{
+			Trailer: &pb.Trailer{Size: size, Digest: hex.EncodeToString(h.Sum(nil))},
+		},
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Revert(ctx context.Context, req *pb.RevertRequest) (*pb.RevertResponse, error) {
+	owner, folder := req.GetOwner(), req.GetFolderName()
+	if err := authorize(ctx, req.GetUsername(), req.GetPassword(), owner, folder); err != nil {
+		return nil, err
+	}
+	branch := req.GetBranch()
+	if branch == "" {
+		branch = versions.DefaultBranch
+	}
+	head, err := Versions.Head(ctx, owner, folder, branch)
+	if err != nil {
+		return nil, versionError(err, branch)
+	}
+	target, err := Versions.Resolve(ctx, owner, folder, req.GetVersion())
+	if err != nil {
+		return nil, versionError(err, req.GetVersion())
+	}
+	if target.Digest == head.Digest {
+		return nil, status.Error(codes.FailedPrecondition,
+			fmt.Sprintf("The branch %s is already at %s", branch, target.Digest))
+	}
+	if _, err = Versions.Manifest(ctx, target); err != nil {
+		return nil, internalError("Cannot load the manifest of %s: %v", target.Digest, err)
+	}
+	archive, err := Versions.Revert(ctx, target, branch, head, owner, req.GetMessage())
+	if err == versions.ErrStale {
+		return nil, status.Error(codes.Aborted,
+			fmt.Sprintf("The branch %s moved while reverting, try again", branch))
+	}
+	if err != nil {
+		return nil, internalError("Cannot revert %s/%s to %s: %v", owner, folder, target.Digest, err)
+	}
+	// the history keeps the bad version, only the served files go back
+	err = Versions.PublishHead(ctx, utils.ROOT, owner, folder, branch)
+	if err != nil {
+		log.Printf("Cannot publish %s/%s: %v", owner, folder, err)
+		if err = Versions.Unrecord(context.Background(), archive, branch, head); err != nil {
+			log.Printf("Cannot undo the revert of %s/%s to %s: %v", owner, folder, target.Digest, err)
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	return &pb.RevertResponse{Version: versionInfo(archive)}, nil
+}
@@ -8,8 +8,6 @@ import (
 	"log"
 	"net"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/BENSARI-Fathi/imagehub/v1/pb"
@@ -22,23 +20,34 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/store"
 	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/versions"
 )
 
-var UserCollection, ImageCollection, RepositoryCollection *mongo.Collection
+var UserCollection, ImageCollection, RepositoryCollection, TagCollection, BranchCollection *mongo.Collection
+
+var (
+	Blobs    = store.New(utils.OBJECTS_ROOT)
+	Versions *versions.Versions
+)
 
 type Server struct {
 	pb.UnimplementedImageReposServer
 }
 
 func (s *Server) Clone(req *pb.CloneRequest, stream pb.ImageRepos_CloneServer) error {
-	fullPath := req.GetReposPath()
-	// remove the url from path
-	repos := strings.Split(fullPath, utils.URL)[1]
-	// extract username
-	path := strings.Split(repos, "/")
-	username := path[0]
-	folder := path[1]
+	release, err := acquireStream(clientAddress(stream.Context()))
+	if err != nil {
+		return err
+	}
+	defer release()
+	// the path may be a url of any server, or just <owner>/<folder>
+	username, folder, ok := utils.SplitReposPath(req.GetReposPath())
+	if !ok {
+		return status.Error(codes.InvalidArgument,
+			fmt.Sprintf("Invalid repository path %s, expected <owner>/<repository>", req.GetReposPath()))
+	}
 	// verify if the user exists
 	user := &models.User{}
 	filter := bson.M{"username": username}
@@ -56,43 +65,48 @@ func (s *Server) Clone(req *pb.CloneRequest, stream pb.ImageRepos_CloneServer) e
 			fmt.Sprintf("Cannot find image repos with the provided folder name: %s", folder),
 		)
 	}
-	// get the last version of the zipfile
-	archive := &models.Archive{}
-	opts := options.FindOne()
-	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
-	filter2 := bson.D{
-		{Key: "username", Value: username},
-		{Key: "folder_name", Value: folder},
+	// get the requested version, the last one by default
+	archive, err := Versions.Resolve(context.Background(), username, folder, req.GetVersion())
+	if err != nil {
+		return versionError(err, req.GetVersion())
 	}
-	res = ImageCollection.FindOne(context.Background(), filter2, opts)
-	if err := res.Decode(archive); err != nil {
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Cannot find the correct zipfile"),
-		)
+	manifest, err := Versions.Manifest(context.Background(), archive)
+	if err != nil {
+		log.Printf("Cannot load the manifest of %s/%s: %v", username, folder, err)
+		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
 	}
-	// send repos hash
-	stream.Send(&pb.CloneResponse{
+	// send repos digest
+	err = stream.Send(&pb.CloneResponse{
 		Data: &pb.CloneResponse_Metadata{
 			Metadata: &pb.MetaData{
+				// clients older than version digests only read the hash,
+				// it stays empty for the archives pushed since
 				Hash:       archive.Hash,
+				Digest:     archive.Digest,
 				Owner:      archive.Username,
 				FolderName: archive.FolderName,
+				Branch:     branchName(context.Background(), username, folder, req.GetVersion()),
+				Size:       manifest.Size(),
+				FileCount:  int32(len(manifest.Entries)),
 			},
 		},
 	})
-	//send data by chunk
-	filename := fmt.Sprintf("./archive/%s/%s", username, archive.ZipFile)
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		fmt.Println("le fichier est introuvable")
-	}
-	f, err := os.Open(filename)
-	defer f.Close()
 	if err != nil {
-		return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+		return err
 	}
-	r := bufio.NewReader(f)
-	buffer := make([]byte, 0, 4*1024)
+	if req.GetFiles() {
+		return sendFiles(req, stream, manifest)
+	}
+	// legacy mode for clients that don't ask for files: the zip is built
+	// from the blob store while being sent, without checksum nor trailer
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(Blobs.WriteZip(pw, manifest))
+	}()
+	//send data by chunk
+	r := bufio.NewReader(pr)
+	buffer := make([]byte, 0, chunkSize(req.GetChunkSize()))
 	for {
 		n, err := r.Read(buffer[:cap(buffer)])
 		if err != nil {
@@ -102,11 +116,14 @@ func (s *Server) Clone(req *pb.CloneRequest, stream pb.ImageRepos_CloneServer) e
 			return status.Error(codes.Internal, fmt.Sprintf("Internal Error here"))
 		}
 		buffer = buffer[:n]
-		stream.Send(&pb.CloneResponse{
+		err = stream.Send(&pb.CloneResponse{
 			Data: &pb.CloneResponse_ChunkData{
 				ChunkData: buffer,
 			},
 		})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -163,10 +180,6 @@ func (s *Server) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Reg
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = os.Mkdir(fmt.Sprintf("archive/%s", username), 0755)
-	if err != nil {
-		log.Fatal(err)
-	}
 	// send response to the client
 	return &pb.RegisterResponse{
 		Id:       oid.Hex(),
@@ -186,9 +199,23 @@ func (s *Server) Push(stream pb.ImageRepos_PushServer) error {
 	user := &models.User{}
 	username := req.GetInfo().GetUsername()
 	password := req.GetInfo().GetPassword()
-	hash := req.GetInfo().GetHash()
+	digest := req.GetInfo().GetDigest()
+	message := req.GetInfo().GetMessage()
+	base := req.GetInfo().GetBase()
+	force := req.GetInfo().GetForce()
+	branch := req.GetInfo().GetBranch()
+	if branch == "" {
+		branch = versions.DefaultBranch
+	}
+	entries := req.GetInfo().GetManifest()
+	partial := req.GetInfo().GetPartial()
+	blobs := req.GetInfo().GetBlobs()
 	reposPath := req.GetInfo().GetReposPath()
-	folderName := filepath.Base(reposPath)
+	owner, folderName, ok := utils.SplitReposPath(reposPath)
+	if !ok {
+		return status.Error(codes.InvalidArgument,
+			fmt.Sprintf("Invalid repository path %s, expected <owner>/<repository>", reposPath))
+	}
 	filter := bson.D{
 		{Key: "$or", Value: bson.A{
 			bson.D{{Key: "username", Value: username}},
@@ -196,14 +223,15 @@ func (s *Server) Push(stream pb.ImageRepos_PushServer) error {
 		}},
 	}
 	err = UserCollection.FindOne(context.Background(), filter).Decode(&user)
-	if !strings.Contains(reposPath, user.Username) {
+	if err != nil {
 		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("No repository found in %s", reposPath),
+			Result: fmt.Sprintf("Invalid username field: %s", username),
 		})
 	}
-	if err != nil {
+	// users push to their own repositories
+	if owner != user.Username {
 		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Invalid username field: %s", username),
+			Result: fmt.Sprintf("No repository found in %s", reposPath),
 		})
 	}
 	// verify password validity
@@ -212,107 +240,117 @@ func (s *Server) Push(stream pb.ImageRepos_PushServer) error {
 			Result: fmt.Sprintf("The provided password is invalid"),
 		})
 	}
-	// check if the repository exist otherwise create a new one
-	filter = bson.D{
-
-		{Key: "username", Value: username},
-		{Key: "folder_name", Value: folderName},
-	}
-	count, _ := RepositoryCollection.CountDocuments(context.Background(), filter)
-	if count == 0 {
-		newRepos := &models.Repository{
-			Username:   user.Username,
-			FolderName: folderName,
-			Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
-		}
-		_, err = RepositoryCollection.InsertOne(context.Background(), newRepos)
-		if err != nil {
-			return stream.SendAndClose(&pb.PushResponse{
-				Result: fmt.Sprintf("Internal Server Error while creating new repository"),
-			})
-		}
-	}
-	// create the zip file
-	zipFileName := fmt.Sprintf("%s-%v.zip", folderName, hash)
-	f, err := os.Create(zipFileName)
-	defer f.Close()
+	release, err := acquireStream(user.Username)
 	if err != nil {
+		return err
+	}
+	defer release()
+	ctx := stream.Context()
+	// refuse a push that would silently drop the versions pushed since base
+	head, err := Versions.Head(ctx, user.Username, folderName, branch)
+	if err == versions.ErrNotFound && branch != versions.DefaultBranch {
+		return status.Error(codes.NotFound,
+			fmt.Sprintf("Cannot find the branch %s, create it with imagehub branch first", branch))
+	}
+	if err != nil && err != versions.ErrNotFound {
 		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Internal server error"),
+			Result: fmt.Sprintf("Internal Server Error while checking the archives"),
 		})
 	}
-	for {
-		req, err = stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return stream.SendAndClose(&pb.PushResponse{
-				Result: fmt.Sprintf("Internal server error"),
-			})
-		}
-		_, err = f.Write(req.GetChunkData())
+	headDigest := ""
+	if head != nil {
+		headDigest = head.Digest
+	}
+	if !force && base != headDigest && digest != headDigest {
+		return staleError(base, headDigest)
+	}
+	// the files come one by one, older clients send a zip archive
+	var manifest *store.Manifest
+	if blobs {
+		var u *blobUpload
+		u, err = openBlobUpload(req.GetInfo().GetUploadId(), uploadInfo{
+			Username: user.Username,
+			Folder:   folderName,
+			Branch:   branch,
+			Digest:   digest,
+		})
 		if err != nil {
-			return stream.SendAndClose(&pb.PushResponse{
-				Result: fmt.Sprintf("Internal server error"),
-			})
+			return err
 		}
-	}
-
-	//unzip the file to images folder
-	err = utils.Unzip(zipFileName, fmt.Sprintf("images/%s/%s", user.Username, folderName))
-	if err != nil {
-		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Internal server error"),
+		var streamed []*pb.FileHeader
+		manifest, streamed, err = receiveBlobs(stream, u)
+		entries = append(entries, streamed...)
+		// the push creating the version comes once every file arrived
+		u.close(err == nil && !partial)
+	} else {
+		manifest, err = receiveZip(stream, uploadInfo{
+			Username: user.Username,
+			Folder:   folderName,
+			Branch:   branch,
+			Digest:   digest,
+			Size:     req.GetInfo().GetSize(),
 		})
 	}
-
-	// move the zip file into the archive
-	err = os.Rename(zipFileName, fmt.Sprintf("archive/%s/%s", user.Username, zipFileName))
 	if err != nil {
+		return err
+	}
+	if partial {
+		// the version is created by the push sent once every part arrived
 		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Internal server error"),
+			Result: fmt.Sprintf("Received %d file(s) for %s/%s", len(manifest.Entries), user.Username, folderName),
 		})
 	}
-
-	// save the zipfile info in db if the zipfile doesn't exitst
-	filter = bson.D{
-		{Key: "username", Value: user.Username},
-		{Key: "zip_file", Value: zipFileName},
+	// a delta push only uploaded the missing blobs, the version is
+	// assembled from them and the ones already stored
+	if blobs || len(entries) > 0 {
+		manifest, err = Blobs.Assemble(toEntries(entries))
+		if err != nil {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("The pushed version is incomplete: %v", err))
+		}
+	}
+	// the version digest is computed from what actually arrived
+	if digest != "" && manifest.Digest() != digest {
+		return status.Error(codes.DataLoss,
+			fmt.Sprintf("The uploaded content doesn't match the version %s", digest))
 	}
-	count, err = ImageCollection.CountDocuments(context.Background(), filter)
+	digest = manifest.Digest()
+	manifestDigest, err := Blobs.PutManifest(manifest)
 	if err != nil {
-		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Internal Server Error while checking the archives"),
-		})
+		return internalError("Cannot store the manifest of %s: %v", digest, err)
 	}
-	if count != 0 {
+	metadata := &pb.MetaData{
+		Digest:     digest,
+		Owner:      user.Username,
+		FolderName: folderName,
+		Branch:     branch,
+		Size:       manifest.Size(),
+		FileCount:  int32(len(manifest.Entries)),
+	}
+	if digest == headDigest {
 		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Successfully pushed to %s%s/%s", utils.URL, username, folderName),
+			Result:   fmt.Sprintf("Everything up-to-date in %s/%s", user.Username, folderName),
+			Metadata: metadata,
 		})
 	}
+
+	// the new version goes on top of the current head of the repository
 	newArchive := &models.Archive{
 		Username:   user.Username,
-		Hash:       hash,
-		ZipFile:    zipFileName,
+		Author:     user.Username,
+		Message:    message,
+		Digest:     digest,
+		Manifest:   manifestDigest,
 		FolderName: folderName,
+		Size:       manifest.Size(),
+		FileCount:  len(manifest.Entries),
 		Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
 	}
-	resp, err := ImageCollection.InsertOne(context.Background(), newArchive)
-	if err != nil {
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Error while creating %v", user),
-		)
-	}
-	_, ok := resp.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return stream.SendAndClose(&pb.PushResponse{
-			Result: fmt.Sprintf("Error while parsing the inserted ID "),
-		})
+	if err = commit(ctx, newArchive, branch, head); err != nil {
+		return err
 	}
 	return stream.SendAndClose(&pb.PushResponse{
-		Result: fmt.Sprintf("Successfully pushed to %s%s/%s", utils.URL, username, folderName),
+		Result:   fmt.Sprintf("Successfully pushed to %s/%s", username, folderName),
+		Metadata: metadata,
 	})
 }
 
@@ -320,40 +358,30 @@ func (s *Server) Check(ctx context.Context, req *pb.CheckRequest) (*pb.CheckResp
 	// get the metadata
 	metadata := req.GetMetadata()
 	// check if the provided version already exist
-	filter := bson.D{
-		{Key: "username", Value: metadata.GetOwner()},
-		{Key: "folder_name", Value: metadata.GetFolderName()},
-		{Key: "hash", Value: metadata.GetHash()},
+	current, err := findVersion(ctx, metadata)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Error(codes.Internal,
+			fmt.Sprintf("The provided version is invalid %s", versionName(metadata)))
 	}
-	count, err := ImageCollection.CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
 	}
-	if count == 0 {
-		return nil, status.Error(codes.Internal,
-			fmt.Sprintf("The provided hash is invalid %v", metadata.GetHash()))
-	}
-	// check if the provided version is the last version
-	archive := &models.Archive{}
-	opts := options.FindOne()
-	opts.SetSort(bson.D{{Key: "timestamp", Value: -1}})
-	filter2 := bson.D{
-		{Key: "username", Value: metadata.GetOwner()},
-		{Key: "folder_name", Value: metadata.GetFolderName()},
-	}
-	err = ImageCollection.FindOne(ctx, filter2, opts).Decode(archive)
+	// check if the provided version is the last version of its branch
+	archive, err := Versions.Head(ctx, metadata.GetOwner(), metadata.GetFolderName(), metadata.GetBranch())
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
 	}
-	result := archive.Hash == metadata.GetHash()
+	result := archive.Digest == current.Digest
 	// send an answer
 	if result {
 		return &pb.CheckResponse{
 			Status: pb.CheckStatus_UpToDate,
+			Digest: current.Digest,
 		}, nil
 	}
 	return &pb.CheckResponse{
 		Status: pb.CheckStatus_UpdateFound,
+		Digest: current.Digest,
 	}, nil
 }
 
@@ -369,11 +397,24 @@ func main() {
 	UserCollection = client.Database("mydb").Collection("user")
 	ImageCollection = client.Database("mydb").Collection("imagehub")
 	RepositoryCollection = client.Database("mydb").Collection("repository")
+	TagCollection = client.Database("mydb").Collection("tag")
+	BranchCollection = client.Database("mydb").Collection("branch")
+	Versions = versions.New(Blobs, utils.ARCHIVE_ROOT, ImageCollection, TagCollection, BranchCollection)
+	if err = Versions.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Cannot create the indexes %v", err)
+	}
 	defer func() {
 		if err = client.Disconnect(context.TODO()); err != nil {
 			log.Fatalf("Disconnect error: %v", err)
 		}
 	}()
+	// uploads nobody resumed are dropped after a while
+	go func() {
+		for {
+			cleanUploads()
+			time.Sleep(time.Hour)
+		}
+	}()
 	lis, err := net.Listen("tcp", "0.0.0.0:50051")
 	if err != nil {
 		log.Fatalf("Can't listen %v", err)
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Tag(ctx context.Context, req *pb.TagRequest) (*pb.TagResponse, error) {
+	// only the owner names the versions of a repository
+	if err := authorize(ctx, req.GetUsername(), req.GetPassword(), req.GetOwner(), req.GetFolderName()); err != nil {
+		return nil, err
+	}
+	archive, err := Versions.Resolve(ctx, req.GetOwner(), req.GetFolderName(), req.GetVersion())
+	if err != nil {
+		return nil, versionError(err, req.GetVersion())
+	}
+	tag, err := Versions.CreateTag(ctx, archive, req.GetName(), req.GetOwner(), req.GetMessage())
+	switch err {
+	case nil:
+	case versions.ErrInvalidName:
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid tag name %q", req.GetName()))
+	case versions.ErrTagExists:
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("The tag %s already exists", req.GetName()))
+	case versions.ErrNameTaken:
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("%s is already the name of a branch", req.GetName()))
+	default:
+		log.Printf("Cannot create the tag %s of %s/%s: %v", req.GetName(), req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	return &pb.TagResponse{Tag: tagInfo(tag)}, nil
+}
+
+func (s *Server) ListTags(ctx context.Context, req *pb.ListTagsRequest) (*pb.ListTagsResponse, error) {
+	tags, err := Versions.Tags(ctx, req.GetOwner(), req.GetFolderName())
+	if err != nil {
+		log.Printf("Cannot list the tags of %s/%s: %v", req.GetOwner(), req.GetFolderName(), err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+	}
+	resp := &pb.ListTagsResponse{}
+	for _, tag := range tags {
+		resp.Tags = append(resp.Tags, tagInfo(tag))
+	}
+	return resp, nil
+}
+
+func tagInfo(tag *models.Tag) *pb.Tag {
+	return &pb.Tag{
+		Name:      tag.Name,
+		Digest:    tag.Digest,
+		Tagger:    tag.Tagger,
+		Timestamp: int64(tag.Timestamp.T),
+		Message:   tag.Message,
+	}
+}
+
+// authenticate returns the user with the given username or email when the
+// password matches.
+func authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	user := &models.User{}
+	filter := bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "username", Value: username}},
+			bson.D{{Key: "email", Value: username}},
+		}},
+	}
+	err := UserCollection.FindOne(ctx, filter).Decode(user)
+	if err != nil || !utils.CheckPasswordHash(password, user.Password) {
+		return nil, status.Error(codes.Unauthenticated, fmt.Sprintf("Invalid username or password"))
+	}
+	return user, nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadMaxAge is how long an interrupted upload can be resumed.
+const uploadMaxAge = 24 * time.Hour
+
+// uploadInfo binds an upload session to the push that started it.
+type uploadInfo struct {
+	Username string `json:"username"`
+	Folder   string `json:"folder"`
+	Branch   string `json:"branch"`
+	Digest   string `json:"digest"`
+	Size     int64  `json:"size"`
+}
+
+// upload is a zip archive being received in uploads/<id>.
+type upload struct {
+	id   string
+	dir  string
+	info uploadInfo
+	f    *os.File
+}
+
+var (
+	uploadsMu sync.Mutex
+	// uploads receiving data, a session is written by one push at a time,
+	// a file of a blobs session by one stream, keyed <id>/<digest>
+	activeUploads = map[string]bool{}
+)
+
+// openUpload starts a new upload session for a zip archive. Clients
+// sending zips can't resume them, only blobs uploads are kept.
+func openUpload(info uploadInfo) (*upload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	uploadsMu.Lock()
+	activeUploads[id] = true
+	uploadsMu.Unlock()
+	u := &upload{id: id, dir: filepath.Join(utils.UPLOADS_ROOT, id), info: info}
+	if err := u.open(); err != nil {
+		u.release()
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *upload) open() error {
+	err := bindUpload(u.dir, u.id, u.info)
+	if err != nil {
+		return err
+	}
+	u.f, err = os.OpenFile(u.path(), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return internalError("Cannot open the upload %s: %v", u.id, err)
+	}
+	return nil
+}
+
+// bindUpload creates the session folder dir for the push described by
+// info, or checks that a resumed session was started by the same push.
+func bindUpload(dir, id string, info uploadInfo) error {
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if err == nil {
+		// a resumed upload must be the same push
+		previous := uploadInfo{}
+		if err = json.Unmarshal(data, &previous); err != nil {
+			return internalError("Cannot read the upload %s: %v", id, err)
+		}
+		if previous != info {
+			return status.Error(codes.FailedPrecondition,
+				fmt.Sprintf("The upload %s was started for another push", id))
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return internalError("Cannot read the upload %s: %v", id, err)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return internalError("Cannot create the upload %s: %v", id, err)
+	}
+	// written aside then renamed, the parallel streams of a push may read
+	// it meanwhile
+	tmp, err := os.CreateTemp(dir, "session-*")
+	if err != nil {
+		return internalError("Cannot create the upload %s: %v", id, err)
+	}
+	data, _ = json.Marshal(info)
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, "session.json"))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return internalError("Cannot create the upload %s: %v", id, err)
+	}
+	return nil
+}
+
+// path returns the file receiving the uploaded archive.
+func (u *upload) path() string {
+	return filepath.Join(u.dir, "images.zip")
+}
+
+// offset returns how many bytes were received so far.
+func (u *upload) offset() (int64, error) {
+	fi, err := u.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// write appends data, which must start where the previous chunk ended.
+func (u *upload) write(offset int64, data []byte) error {
+	current, err := u.offset()
+	if err != nil {
+		return internalError("Cannot write the upload %s: %v", u.id, err)
+	}
+	if offset != current {
+		return status.Error(codes.OutOfRange,
+			fmt.Sprintf("The upload %s is at offset %d, got a chunk for %d", u.id, current, offset))
+	}
+	if u.info.Size > 0 && offset+int64(len(data)) > u.info.Size {
+		return status.Error(codes.OutOfRange, fmt.Sprintf("The upload %s is larger than announced", u.id))
+	}
+	if _, err = u.f.Write(data); err != nil {
+		return internalError("Cannot write the upload %s: %v", u.id, err)
+	}
+	return nil
+}
+
+// complete reports whether everything announced was received.
+func (u *upload) complete() (bool, error) {
+	if err := u.f.Sync(); err != nil {
+		return false, err
+	}
+	size, err := u.offset()
+	if err != nil {
+		return false, err
+	}
+	return u.info.Size == 0 || size == u.info.Size, nil
+}
+
+// verify checks the received archive against the trailer of the client.
+func (u *upload) verify(trailer *pb.Trailer) error {
+	digest, size, err := store.HashFile(u.path())
+	if err != nil {
+		return internalError("Cannot read the upload %s: %v", u.id, err)
+	}
+	if size != trailer.GetSize() || digest != trailer.GetDigest() {
+		return status.Error(codes.DataLoss,
+			fmt.Sprintf("The upload %s is corrupted: got %d bytes with digest %s, expected %d bytes with digest %s",
+				u.id, size, digest, trailer.GetSize(), trailer.GetDigest()))
+	}
+	return nil
+}
+
+// remove drops the session once the archive is stored or can't be.
+func (u *upload) remove() {
+	u.f.Close()
+	os.RemoveAll(u.dir)
+	u.release()
+}
+
+func (u *upload) release() {
+	uploadsMu.Lock()
+	delete(activeUploads, u.id)
+	uploadsMu.Unlock()
+}
+
+// receiveZip receives a zip archive and stores its files. A dropped
+// connection loses what was received, the client sends everything again.
+func receiveZip(stream pb.ImageRepos_PushServer, info uploadInfo) (*store.Manifest, error) {
+	u, err := openUpload(info)
+	if err != nil {
+		return nil, err
+	}
+	defer u.remove()
+	var trailer *pb.Trailer
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the client canceled or the connection dropped
+			return nil, err
+		}
+		switch data := req.GetData().(type) {
+		case *pb.PushRequest_Chunk:
+			if utils.Checksum(data.Chunk.GetData()) != data.Chunk.GetChecksum() {
+				return nil, status.Error(codes.Aborted,
+					fmt.Sprintf("The chunk at offset %d of the upload %s is corrupted", data.Chunk.GetOffset(), u.id))
+			}
+			err = u.write(data.Chunk.GetOffset(), data.Chunk.GetData())
+		case *pb.PushRequest_Trailer:
+			trailer = data.Trailer
+		case *pb.PushRequest_ChunkData:
+			// older clients send their chunks in order without offsets
+			var offset int64
+			if offset, err = u.offset(); err == nil {
+				err = u.write(offset, data.ChunkData)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	done, err := u.complete()
+	if err != nil {
+		return nil, internalError("Cannot read the upload %s: %v", u.id, err)
+	}
+	if !done {
+		offset, _ := u.offset()
+		return nil, status.Error(codes.Aborted,
+			fmt.Sprintf("The upload %s stopped at %d of %d bytes", u.id, offset, u.info.Size))
+	}
+	// older clients don't end their uploads with a trailer
+	if trailer != nil {
+		if err = u.verify(trailer); err != nil {
+			return nil, err
+		}
+	}
+	// move the images into the blob store, only new content takes space
+	manifest, err := Blobs.PutZip(u.path())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("The uploaded archive is invalid: %v", err))
+	}
+	return manifest, nil
+}
+
+func (s *Server) QueryUpload(ctx context.Context, req *pb.QueryUploadRequest) (*pb.QueryUploadResponse, error) {
+	id := req.GetUploadId()
+	if !validUploadID(id) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid upload id %q", id))
+	}
+	resp := &pb.QueryUploadResponse{UploadId: id}
+	entries, err := os.ReadDir(filepath.Join(utils.UPLOADS_ROOT, id))
+	if os.IsNotExist(err) {
+		// nothing received yet, the push starts from the beginning
+		return resp, nil
+	}
+	if err != nil {
+		return nil, internalError("Cannot read the upload %s: %v", id, err)
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		// the files of a blobs upload are named by digest
+		if store.ValidDigest(e.Name()) {
+			resp.Files = append(resp.Files, &pb.FileHeader{Digest: e.Name(), Offset: info.Size()})
+		}
+	}
+	return resp, nil
+}
+
+// newUploadID returns a random session id for a zip upload.
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", internalError("Cannot create an upload id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// cleanUploads removes the uploads nobody resumed in time.
+func cleanUploads() {
+	entries, err := os.ReadDir(utils.UPLOADS_ROOT)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		modified, err := lastModified(filepath.Join(utils.UPLOADS_ROOT, e.Name()))
+		if err != nil || time.Since(modified) < uploadMaxAge {
+			continue
+		}
+		uploadsMu.Lock()
+		if !uploadActive(e.Name()) {
+			log.Printf("Removing the abandoned upload %s", e.Name())
+			os.RemoveAll(filepath.Join(utils.UPLOADS_ROOT, e.Name()))
+		}
+		uploadsMu.Unlock()
+	}
+}
+
+// lastModified returns when data last arrived in the upload folder dir,
+// its files change with every chunk but the folder only when one is
+// created.
+func lastModified(dir string) (time.Time, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	latest := info.ModTime()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// uploadActive reports whether a push is writing to the session id, to
+// its archive or to one of its files. uploadsMu must be held.
+func uploadActive(id string) bool {
+	if activeUploads[id] {
+		return true
+	}
+	for key := range activeUploads {
+		if strings.HasPrefix(key, id+"/") {
+			return true
+		}
+	}
+	return false
+}
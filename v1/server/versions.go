@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/v1/pb"
+	"github.com/BENSARI-Fathi/imagehub/versions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// findVersion returns the archive matching the version described by
+// metadata. Clones made before version digests existed only know the
+// legacy hash.
+func findVersion(ctx context.Context, metadata *pb.MetaData) (*models.Archive, error) {
+	return Versions.Find(ctx, metadata.GetOwner(), metadata.GetFolderName(), metadata.GetDigest(), metadata.GetHash())
+}
+
+func versionName(metadata *pb.MetaData) string {
+	if metadata.GetDigest() != "" {
+		return metadata.GetDigest()
+	}
+	return fmt.Sprint(metadata.GetHash())
+}
+
+// versionError turns a failed version lookup into a grpc status.
+func versionError(err error, ref string) error {
+	switch err {
+	case versions.ErrNotFound:
+		return status.Error(codes.NotFound, fmt.Sprintf("Cannot find the version %s", ref))
+	case versions.ErrAmbiguous:
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("The version %s is ambiguous, use more characters", ref))
+	}
+	log.Printf("Cannot resolve the version %s: %v", ref, err)
+	return status.Error(codes.Internal, fmt.Sprintf("Internal Error"))
+}
+
+// branchName returns the branch named by ref, if any, so clients can
+// follow it.
+func branchName(ctx context.Context, owner, folder, ref string) string {
+	if ref == "" {
+		return versions.DefaultBranch
+	}
+	if !versions.ValidName(ref) {
+		return ""
+	}
+	if _, err := Versions.Branch(ctx, owner, folder, ref); err != nil {
+		return ""
+	}
+	return ref
+}
+
+// staleError tells the client its push is not based on the current head.
+func staleError(base, head string) error {
+	if base == "" {
+		base = "no version"
+	}
+	return status.Error(codes.FailedPrecondition,
+		fmt.Sprintf("The push is based on %s but the repository is at %s, pull first or push with --force", base, head))
+}
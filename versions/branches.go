@@ -0,0 +1,276 @@
+package versions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultBranch is the branch served by the web interface, the one used
+// when no branch is named.
+const DefaultBranch = "main"
+
+var (
+	ErrBranchExists  = errors.New("branch already exists")
+	ErrDefaultBranch = errors.New("the default branch can't be deleted")
+	ErrNameTaken     = errors.New("name already used by a tag or a branch")
+	ErrStale         = errors.New("the branch moved on")
+)
+
+// Published returns the folder under root serving the files of a branch,
+// other branches than the default one live in <folder>@<branch>. Pushes
+// refuse repository names with an @, they can't collide.
+func Published(root, owner, folder, branch string) string {
+	if branch != "" && branch != DefaultBranch {
+		folder += "@" + branch
+	}
+	return filepath.Join(root, owner, folder)
+}
+
+// Branch returns a branch of a repository. Repositories pushed before
+// branches existed get their default branch on the last archive.
+func (v *Versions) Branch(ctx context.Context, owner, folder, name string) (*models.Branch, error) {
+	if name == "" {
+		name = DefaultBranch
+	}
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+		{Key: "name", Value: name},
+	}
+	branch := &models.Branch{}
+	err := v.branches.FindOne(ctx, filter).Decode(branch)
+	if err == nil {
+		return branch, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if name != DefaultBranch {
+		return nil, ErrNotFound
+	}
+	archive := &models.Archive{}
+	opts := options.FindOne()
+	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	err = v.archives.FindOne(ctx, bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+	}, opts).Decode(archive)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = v.Manifest(ctx, archive); err != nil {
+		return nil, err
+	}
+	// the branch may have been created concurrently, read it back either way
+	if _, err = v.MoveBranch(ctx, owner, folder, name, nil, archive); err != nil {
+		return nil, err
+	}
+	return v.Branch(ctx, owner, folder, name)
+}
+
+// Branches returns the branches of a repository, the default one first.
+func (v *Versions) Branches(ctx context.Context, owner, folder string) ([]*models.Branch, error) {
+	main, err := v.Branch(ctx, owner, folder, DefaultBranch)
+	if err == ErrNotFound {
+		return []*models.Branch{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var branches []*models.Branch
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "name", Value: 1}})
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+		{Key: "name", Value: bson.M{"$ne": DefaultBranch}},
+	}
+	cursor, err := v.branches.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &branches); err != nil {
+		return nil, err
+	}
+	return append([]*models.Branch{main}, branches...), nil
+}
+
+// CreateBranch starts a new branch on archive.
+func (v *Versions) CreateBranch(ctx context.Context, archive *models.Archive, name string) (*models.Branch, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	if _, err := v.Tag(ctx, archive.Username, archive.FolderName, name); err != ErrNotFound {
+		if err == nil {
+			err = ErrNameTaken
+		}
+		return nil, err
+	}
+	if name == DefaultBranch {
+		// make sure an older repository has its default branch recorded
+		if _, err := v.Branch(ctx, archive.Username, archive.FolderName, name); err != ErrNotFound {
+			if err == nil {
+				err = ErrBranchExists
+			}
+			return nil, err
+		}
+	}
+	moved, err := v.MoveBranch(ctx, archive.Username, archive.FolderName, name, nil, archive)
+	if err != nil {
+		return nil, err
+	}
+	if !moved {
+		return nil, ErrBranchExists
+	}
+	return v.Branch(ctx, archive.Username, archive.FolderName, name)
+}
+
+// DeleteBranch removes a branch, the versions pushed to it stay reachable
+// by their digest.
+func (v *Versions) DeleteBranch(ctx context.Context, owner, folder, name string) (*models.Branch, error) {
+	if name == DefaultBranch || name == "" {
+		return nil, ErrDefaultBranch
+	}
+	branch, err := v.Branch(ctx, owner, folder, name)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.branches.DeleteOne(ctx, bson.M{"_id": branch.ID})
+	if err != nil {
+		return nil, err
+	}
+	if res.DeletedCount == 0 {
+		return nil, ErrNotFound
+	}
+	return branch, nil
+}
+
+// MoveBranch points a branch at the archive to, only if it still points at
+// from. A nil from creates the branch, a nil to deletes it.
+func (v *Versions) MoveBranch(ctx context.Context, owner, folder, name string, from, to *models.Archive) (bool, error) {
+	if from == nil {
+		_, err := v.branches.InsertOne(ctx, &models.Branch{
+			Username:   owner,
+			FolderName: folder,
+			Name:       name,
+			Head:       to.ID,
+			Digest:     to.Digest,
+			Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+		{Key: "name", Value: name},
+		{Key: "head", Value: from.ID},
+	}
+	if to == nil {
+		res, err := v.branches.DeleteOne(ctx, filter)
+		if err != nil {
+			return false, err
+		}
+		return res.DeletedCount == 1, nil
+	}
+	res, err := v.branches.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"head":      to.ID,
+		"digest":    to.Digest,
+		"timestamp": primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// archive returns the archive with the given id.
+func (v *Versions) archive(ctx context.Context, id primitive.ObjectID) (*models.Archive, error) {
+	archive := &models.Archive{}
+	err := v.archives.FindOne(ctx, bson.M{"_id": id}).Decode(archive)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = v.Manifest(ctx, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Record inserts archive as the new head of a branch that must still point
+// at head, a nil head for a new branch. It fails with ErrStale when the
+// branch moved in between.
+func (v *Versions) Record(ctx context.Context, archive *models.Archive, branch string, head *models.Archive) error {
+	if head != nil {
+		archive.Parent = head.ID
+		archive.ParentDigest = head.Digest
+	}
+	resp, err := v.archives.InsertOne(ctx, archive)
+	if err != nil {
+		return err
+	}
+	archive.ID, _ = resp.InsertedID.(primitive.ObjectID)
+	moved, err := v.MoveBranch(ctx, archive.Username, archive.FolderName, branch, head, archive)
+	if err == nil && !moved {
+		err = ErrStale
+	}
+	if err != nil {
+		v.archives.DeleteOne(context.Background(), bson.M{"_id": archive.ID})
+		return err
+	}
+	return nil
+}
+
+// Unrecord undoes Record when a later step of the push failed. When
+// another version was recorded on top of archive meanwhile, it stays in
+// the history and ErrStale is returned.
+func (v *Versions) Unrecord(ctx context.Context, archive *models.Archive, branch string, head *models.Archive) error {
+	moved, err := v.MoveBranch(ctx, archive.Username, archive.FolderName, branch, archive, head)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return ErrStale
+	}
+	_, err = v.archives.DeleteOne(ctx, bson.M{"_id": archive.ID})
+	return err
+}
+
+// Revert records on top of head a new version with the content of target.
+func (v *Versions) Revert(ctx context.Context, target *models.Archive, branch string, head *models.Archive, author, message string) (*models.Archive, error) {
+	if message == "" {
+		message = fmt.Sprintf("Revert to %s", target.Digest)
+	}
+	archive := &models.Archive{
+		Username:   target.Username,
+		Author:     author,
+		Message:    message,
+		Digest:     target.Digest,
+		Manifest:   target.Manifest,
+		FolderName: target.FolderName,
+		Size:       target.Size,
+		FileCount:  target.FileCount,
+		Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}
+	if err := v.Record(ctx, archive, branch, head); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
@@ -0,0 +1,83 @@
+package versions
+
+import (
+	"context"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/store"
+)
+
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+	Renamed  = "renamed"
+)
+
+// FileInfo describes a file on one side of a diff.
+type FileInfo struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// FileChange is a file that differs between two versions, Before is nil for
+// added files and After is nil for removed ones.
+type FileChange struct {
+	Kind   string    `json:"kind"`
+	Before *FileInfo `json:"before,omitempty"`
+	After  *FileInfo `json:"after,omitempty"`
+}
+
+type Diff struct {
+	From    *models.Archive `json:"from"`
+	To      *models.Archive `json:"to"`
+	Changes []FileChange    `json:"changes"`
+}
+
+// Diff compares two versions of a repository.
+func (v *Versions) Diff(ctx context.Context, fromArchive, toArchive *models.Archive) (*Diff, error) {
+	fromManifest, err := v.Manifest(ctx, fromArchive)
+	if err != nil {
+		return nil, err
+	}
+	toManifest, err := v.Manifest(ctx, toArchive)
+	if err != nil {
+		return nil, err
+	}
+	changes := store.Compare(fromManifest, toManifest)
+	changes.DetectRenames()
+	diff := &Diff{From: fromArchive, To: toArchive, Changes: []FileChange{}}
+	for _, e := range changes.Added {
+		diff.Changes = append(diff.Changes, FileChange{Kind: Added, After: v.fileInfo(e)})
+	}
+	for _, e := range changes.Removed {
+		diff.Changes = append(diff.Changes, FileChange{Kind: Removed, Before: v.fileInfo(e)})
+	}
+	beforeByPath := make(map[string]store.Entry, len(fromManifest.Entries))
+	for _, e := range fromManifest.Entries {
+		beforeByPath[e.Path] = e
+	}
+	for _, e := range changes.Modified {
+		diff.Changes = append(diff.Changes, FileChange{
+			Kind:   Modified,
+			Before: v.fileInfo(beforeByPath[e.Path]),
+			After:  v.fileInfo(e),
+		})
+	}
+	for _, r := range changes.Renamed {
+		diff.Changes = append(diff.Changes, FileChange{
+			Kind:   Renamed,
+			Before: v.fileInfo(r.From),
+			After:  v.fileInfo(r.To),
+		})
+	}
+	return diff, nil
+}
+
+func (v *Versions) fileInfo(e store.Entry) *FileInfo {
+	width, height := v.Blobs.Dimensions(e.Digest)
+	return &FileInfo{Path: e.Path, Digest: e.Digest, Size: e.Size, Width: width, Height: height}
+}
@@ -0,0 +1,80 @@
+package versions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	publishMu    sync.Mutex
+	publishLocks = map[string]*sync.Mutex{}
+)
+
+// PublishHead makes the folder under root serving a branch show the files
+// of its head. Pushes and reverts publish after moving the branch, so the
+// head is read again under a lock: the last publisher always serves the
+// newest version, and never a snapshot another one is removing.
+func (v *Versions) PublishHead(ctx context.Context, root, owner, folder, branch string) error {
+	name := Published(root, owner, folder, branch)
+	unlock, err := lockPublished(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	head, err := v.Head(ctx, owner, folder, branch)
+	if err != nil {
+		return err
+	}
+	manifest, err := v.Manifest(ctx, head)
+	if err != nil {
+		return err
+	}
+	return v.Blobs.Publish(name, manifest)
+}
+
+// Unpublish removes the folder under root serving a branch.
+func (v *Versions) Unpublish(root, owner, folder, branch string) error {
+	name := Published(root, owner, folder, branch)
+	unlock, err := lockPublished(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return v.Blobs.Unpublish(name)
+}
+
+// lockPublished serializes the publications of the folder name. The gRPC
+// and the web servers both publish, the file lock covers the other
+// process.
+func lockPublished(name string) (func(), error) {
+	publishMu.Lock()
+	mu, ok := publishLocks[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		publishLocks[name] = mu
+	}
+	publishMu.Unlock()
+	mu.Lock()
+	parent, base := filepath.Split(name)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(parent, "."+base+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+		mu.Unlock()
+	}, nil
+}
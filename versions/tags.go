@@ -0,0 +1,127 @@
+package versions
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTagExists   = errors.New("tag already exists")
+	ErrInvalidName = errors.New("invalid tag or branch name")
+)
+
+var tagName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+
+// ValidName reports whether name can be used as a tag or a branch. Names
+// that could be read as a digest prefix are refused so a version always has
+// one meaning.
+func ValidName(name string) bool {
+	if !tagName.MatchString(name) {
+		return false
+	}
+	_, err := hex.DecodeString(name + name[:len(name)%2])
+	return err != nil || len(name) < MinPrefix
+}
+
+// EnsureIndexes creates the indexes keeping tag and branch names unique
+// per repository.
+func (v *Versions) EnsureIndexes(ctx context.Context) error {
+	for _, c := range []*mongo.Collection{v.tags, v.branches} {
+		_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "username", Value: 1},
+				{Key: "folder_name", Value: 1},
+				{Key: "name", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTag names archive, tags can't be moved or deleted once created.
+func (v *Versions) CreateTag(ctx context.Context, archive *models.Archive, name, tagger, message string) (*models.Tag, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	if _, err := v.Tag(ctx, archive.Username, archive.FolderName, name); err != ErrNotFound {
+		if err == nil {
+			err = ErrTagExists
+		}
+		return nil, err
+	}
+	if _, err := v.Branch(ctx, archive.Username, archive.FolderName, name); err != ErrNotFound {
+		if err == nil {
+			err = ErrNameTaken
+		}
+		return nil, err
+	}
+	tag := &models.Tag{
+		Username:   archive.Username,
+		FolderName: archive.FolderName,
+		Name:       name,
+		Archive:    archive.ID,
+		Digest:     archive.Digest,
+		Tagger:     tagger,
+		Message:    message,
+		Timestamp:  primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}
+	resp, err := v.tags.InsertOne(ctx, tag)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrTagExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	tag.ID, _ = resp.InsertedID.(primitive.ObjectID)
+	return tag, nil
+}
+
+// Tag returns the tag of a repository with the given name.
+func (v *Versions) Tag(ctx context.Context, owner, folder, name string) (*models.Tag, error) {
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+		{Key: "name", Value: name},
+	}
+	tag := &models.Tag{}
+	err := v.tags.FindOne(ctx, filter).Decode(tag)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// Tags returns the tags of a repository, newest first.
+func (v *Versions) Tags(ctx context.Context, owner, folder string) ([]*models.Tag, error) {
+	tags := []*models.Tag{}
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+	}
+	cursor, err := v.tags.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
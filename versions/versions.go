@@ -0,0 +1,217 @@
+package versions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/BENSARI-Fathi/imagehub/models"
+	"github.com/BENSARI-Fathi/imagehub/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MinPrefix is the shortest digest prefix accepted to name a version.
+const MinPrefix = 4
+
+var (
+	ErrNotFound  = errors.New("unknown version")
+	ErrAmbiguous = errors.New("ambiguous version prefix")
+)
+
+// Versions looks up the versions pushed to the repositories, it is shared
+// by the grpc server and the rest api.
+type Versions struct {
+	Blobs    *store.Store
+	archives *mongo.Collection
+	tags     *mongo.Collection
+	branches *mongo.Collection
+	// legacy is the folder holding the zip files of old archives
+	legacy string
+}
+
+func New(blobs *store.Store, legacy string, archives, tags, branches *mongo.Collection) *Versions {
+	return &Versions{Blobs: blobs, archives: archives, tags: tags, branches: branches, legacy: legacy}
+}
+
+// Manifest returns the tree of an archive. Archives pushed before the blob
+// store existed only have a zip file and a FNV hash, they are imported and
+// given a version digest, size and file count on first use.
+func (v *Versions) Manifest(ctx context.Context, archive *models.Archive) (*store.Manifest, error) {
+	var (
+		manifest *store.Manifest
+		err      error
+	)
+	if archive.Manifest != "" {
+		manifest, err = v.Blobs.Manifest(archive.Manifest)
+	} else {
+		manifest, err = v.Blobs.PutZip(filepath.Join(v.legacy, archive.Username, archive.ZipFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if archive.Manifest != "" && archive.Digest != "" && archive.FileCount == len(manifest.Entries) {
+		return manifest, nil
+	}
+	// fill in what older archives are missing
+	manifestDigest, err := v.Blobs.PutManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	archive.Manifest = manifestDigest
+	archive.Digest = manifest.Digest()
+	archive.Size = manifest.Size()
+	archive.FileCount = len(manifest.Entries)
+	_, err = v.archives.UpdateOne(ctx, bson.M{"_id": archive.ID}, bson.M{"$set": bson.M{
+		"manifest":   archive.Manifest,
+		"digest":     archive.Digest,
+		"size":       archive.Size,
+		"file_count": archive.FileCount,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Find returns the archive of a repository with the given digest. Clones
+// made before version digests existed only know the legacy hash.
+func (v *Versions) Find(ctx context.Context, owner, folder, digest string, hash uint32) (*models.Archive, error) {
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+	}
+	if digest != "" {
+		filter = append(filter, bson.E{Key: "digest", Value: digest})
+	} else {
+		filter = append(filter, bson.E{Key: "hash", Value: hash})
+	}
+	archive := &models.Archive{}
+	if err := v.archives.FindOne(ctx, filter).Decode(archive); err != nil {
+		return nil, err
+	}
+	if _, err := v.Manifest(ctx, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Head returns the archive a branch points to, the default branch when
+// branch is empty.
+func (v *Versions) Head(ctx context.Context, owner, folder, branch string) (*models.Archive, error) {
+	b, err := v.Branch(ctx, owner, folder, branch)
+	if err != nil {
+		return nil, err
+	}
+	return v.archive(ctx, b.Head)
+}
+
+// Resolve returns the version of a repository named by ref: the head of
+// the default branch when ref is empty, the head of a branch or the tagged
+// version when ref is a name, otherwise the version whose digest starts
+// with ref.
+func (v *Versions) Resolve(ctx context.Context, owner, folder, ref string) (*models.Archive, error) {
+	if ref == "" {
+		return v.Head(ctx, owner, folder, DefaultBranch)
+	}
+	if ValidName(ref) {
+		archive, err := v.Head(ctx, owner, folder, ref)
+		if err != ErrNotFound {
+			return archive, err
+		}
+		tag, err := v.Tag(ctx, owner, folder, ref)
+		if err != nil {
+			return nil, err
+		}
+		return v.archive(ctx, tag.Archive)
+	}
+	if len(ref) < MinPrefix || len(ref) > sha256.Size*2 {
+		return nil, ErrNotFound
+	}
+	if _, err := hex.DecodeString(ref + strings.Repeat("0", len(ref)%2)); err != nil {
+		return nil, ErrNotFound
+	}
+	var archives []*models.Archive
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+		{Key: "digest", Value: primitive.Regex{Pattern: "^" + strings.ToLower(ref)}},
+	}
+	cursor, err := v.archives.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &archives); err != nil {
+		return nil, err
+	}
+	if len(archives) == 0 {
+		return nil, ErrNotFound
+	}
+	for _, archive := range archives[1:] {
+		if archive.Digest != archives[0].Digest {
+			return nil, ErrAmbiguous
+		}
+	}
+	if _, err = v.Manifest(ctx, archives[0]); err != nil {
+		return nil, err
+	}
+	return archives[0], nil
+}
+
+// History returns the versions of a branch, following the parent links
+// from its head. Archives pushed before parents were recorded have no
+// author, their parent is taken to be the previous archive.
+func (v *Versions) History(ctx context.Context, owner, folder, branch string) ([]*models.Archive, error) {
+	head, err := v.Branch(ctx, owner, folder, branch)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var archives []*models.Archive
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	filter := bson.D{
+		{Key: "username", Value: owner},
+		{Key: "folder_name", Value: folder},
+	}
+	cursor, err := v.archives.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &archives); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]int, len(archives))
+	for i, archive := range archives {
+		byID[archive.ID] = i
+	}
+	var history []*models.Archive
+	visited := make(map[primitive.ObjectID]bool, len(archives))
+	i, ok := byID[head.Head]
+	for ok && !visited[archives[i].ID] {
+		archive := archives[i]
+		visited[archive.ID] = true
+		if _, err = v.Manifest(ctx, archive); err != nil {
+			return nil, err
+		}
+		history = append(history, archive)
+		switch {
+		case !archive.Parent.IsZero():
+			i, ok = byID[archive.Parent]
+		case archive.Author == "":
+			i, ok = i+1, i+1 < len(archives)
+		default:
+			ok = false
+		}
+	}
+	return history, nil
+}
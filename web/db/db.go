@@ -13,6 +13,8 @@ type MongoClient struct {
 	UserCollection    *mongo.Collection
 	ReposCollecion    *mongo.Collection
 	ArchiveCollection *mongo.Collection
+	TagCollection     *mongo.Collection
+	BranchCollection  *mongo.Collection
 }
 
 func NewMongoClient() (*MongoClient, error) {
@@ -28,5 +30,7 @@ func NewMongoClient() (*MongoClient, error) {
 		UserCollection:    client.Database("mydb").Collection("user"),
 		ReposCollecion:    client.Database("mydb").Collection("repository"),
 		ArchiveCollection: client.Database("mydb").Collection("imagehub"),
+		TagCollection:     client.Database("mydb").Collection("tag"),
+		BranchCollection:  client.Database("mydb").Collection("branch"),
 	}, nil
 }
@@ -9,7 +9,9 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/BENSARI-Fathi/imagehub/store"
 	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/versions"
 	"github.com/BENSARI-Fathi/imagehub/web/auth"
 	"github.com/BENSARI-Fathi/imagehub/web/db"
 	"github.com/BENSARI-Fathi/imagehub/web/middleware"
@@ -47,7 +49,8 @@ func main() {
 		log.Fatal(err)
 	}
 	account := views.NewAccount(rd, tk, mg)
-	repos := views.NewRepository(rd, tk, mg)
+	vs := versions.New(store.New("../"+utils.OBJECTS_ROOT), "../"+utils.ARCHIVE_ROOT, mg.ArchiveCollection, mg.TagCollection, mg.BranchCollection)
+	repos := views.NewRepository(rd, tk, mg, vs)
 
 	// Set a lower memory limit for multipart forms (default is 32 MiB)
 	router.MaxMultipartMemory = utils.MAX_FILE_SIZE
@@ -69,6 +72,13 @@ func main() {
 		api.POST("repos/link", repos.GenerateReposUrl)
 		api.GET("repos/search", repos.SearchRepository)
 		api.GET("repos/:id", repos.GetFolderDetail)
+		api.GET("repos/:id/versions", repos.GetVersions)
+		api.GET("repos/:id/diff", repos.GetDiff)
+		api.GET("repos/:id/branches", repos.GetBranches)
+		api.GET("repos/:id/tags", repos.GetTags)
+		api.POST("repos/:id/tags", middleware.TokenAuthMiddleware(), repos.CreateTag)
+		api.GET("repos/:id/download", repos.Download)
+		api.POST("repos/:id/revert", middleware.TokenAuthMiddleware(), repos.Revert)
 	}
 
 	// serve static and media file
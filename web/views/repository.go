@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/BENSARI-Fathi/imagehub/models"
 	"github.com/BENSARI-Fathi/imagehub/utils"
+	"github.com/BENSARI-Fathi/imagehub/versions"
 	"github.com/BENSARI-Fathi/imagehub/web/auth"
 	"github.com/BENSARI-Fathi/imagehub/web/db"
 	"github.com/gin-gonic/gin"
@@ -17,19 +20,32 @@ import (
 )
 
 type imageFile struct {
-	FileName string `json:"filename"`
-	Url      string `json:"url"`
-	// todo add url field
+	FileName string      `json:"filename"`
+	Url      string      `json:"url,omitempty"`
+	IsDir    bool        `json:"is_dir"`
+	Children []imageFile `json:"children,omitempty"`
+}
+
+// version lists the same fields as the History RPC.
+type version struct {
+	Digest    string `json:"digest"`
+	Author    string `json:"author"`
+	Timestamp int64  `json:"timestamp"`
+	Size      int64  `json:"size"`
+	FileCount int    `json:"file_count"`
+	Message   string `json:"message,omitempty"`
+	Parent    string `json:"parent,omitempty"`
 }
 
 type repository struct {
 	rd auth.AuthInterface
 	tk auth.TokenInterface
 	mg *db.MongoClient
+	vs *versions.Versions
 }
 
-func NewRepository(rd auth.AuthInterface, tk auth.TokenInterface, mg *db.MongoClient) *repository {
-	return &repository{rd: rd, tk: tk, mg: mg}
+func NewRepository(rd auth.AuthInterface, tk auth.TokenInterface, mg *db.MongoClient, vs *versions.Versions) *repository {
+	return &repository{rd: rd, tk: tk, mg: mg, vs: vs}
 }
 
 func (rep *repository) GetRepos(c *gin.Context) {
@@ -82,22 +98,325 @@ func (rep *repository) GetFolderDetail(c *gin.Context) {
 		return
 	}
 	owner := repository.Username
-	folder := repository.FolderName
-	var images []imageFile
+	branch := c.Query("branch")
+	if branch != "" && !versions.ValidName(branch) {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid branch name %q", branch))
+		return
+	}
+	// other branches than the default one are served next to it
+	dir := versions.Published("../"+utils.ROOT, owner, repository.FolderName, branch)
+	folder := filepath.Base(dir)
 
-	files, err := ioutil.ReadDir(fmt.Sprintf("../%s/%s/%s", utils.ROOT, owner, folder))
+	images, err := listFolder(
+		dir,
+		fmt.Sprintf("%s/%s%s/%s", c.Request.Host, utils.MEDIA_URL, owner, folder),
+	)
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, fmt.Sprintf("Cannot find the branch %s", branch))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
+	c.JSON(http.StatusOK, images)
+}
+
+// listFolder returns the content of dir, subfolders come with their own
+// content as children.
+func listFolder(dir, url string) ([]imageFile, error) {
+	var images []imageFile
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
 	for _, file := range files {
 		f := imageFile{
 			FileName: file.Name(),
-			Url:      fmt.Sprintf("%s/%s%s/%s/%s", c.Request.Host, utils.MEDIA_URL, repository.Username, repository.FolderName, file.Name()),
+			IsDir:    file.IsDir(),
+		}
+		if file.IsDir() {
+			f.Children, err = listFolder(filepath.Join(dir, file.Name()), url+"/"+file.Name())
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			f.Url = url + "/" + file.Name()
 		}
 		images = append(images, f)
 	}
-	c.JSON(http.StatusOK, images)
+	return images, nil
+}
+
+func (rep *repository) GetVersions(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	branch := c.Query("branch")
+	archives, err := rep.vs.History(context.Background(), repository.Username, repository.FolderName, branch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(archives) == 0 && branch != "" {
+		c.JSON(http.StatusNotFound, fmt.Sprintf("Cannot find the branch %s", branch))
+		return
+	}
+	if len(archives) == 0 {
+		c.JSON(http.StatusNotFound, fmt.Sprintf("Cannot find image repos %s/%s", repository.Username, repository.FolderName))
+		return
+	}
+	history := make([]version, 0, len(archives))
+	for _, archive := range archives {
+		author := archive.Author
+		if author == "" {
+			// only the owner could push before authors were recorded
+			author = archive.Username
+		}
+		history = append(history, version{
+			Digest:    archive.Digest,
+			Author:    author,
+			Timestamp: int64(archive.Timestamp.T),
+			Size:      archive.Size,
+			FileCount: archive.FileCount,
+			Message:   archive.Message,
+			Parent:    archive.ParentDigest,
+		})
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (rep *repository) GetDiff(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	from, ok := rep.resolveVersion(c, repository, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, ok := rep.resolveVersion(c, repository, c.Query("to"))
+	if !ok {
+		return
+	}
+	diff, err := rep.vs.Diff(context.Background(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (rep *repository) GetBranches(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	branches, err := rep.vs.Branches(context.Background(), repository.Username, repository.FolderName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, branches)
+}
+
+func (rep *repository) GetTags(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	tags, err := rep.vs.Tags(context.Background(), repository.Username, repository.FolderName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+func (rep *repository) CreateTag(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	var data map[string]string
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	// only the owner names the versions of a repository
+	user, ok := rep.checkOwner(c, repository)
+	if !ok {
+		return
+	}
+	archive, ok := rep.resolveVersion(c, repository, data["version"])
+	if !ok {
+		return
+	}
+	tag, err := rep.vs.CreateTag(context.Background(), archive, data["name"], user.Username, data["message"])
+	switch err {
+	case nil:
+		c.JSON(http.StatusCreated, tag)
+	case versions.ErrInvalidName:
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid tag name %q", data["name"]))
+	case versions.ErrTagExists, versions.ErrNameTaken:
+		c.JSON(http.StatusConflict, fmt.Sprintf("The name %s is already used", data["name"]))
+	default:
+		c.JSON(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Revert records a new head with the content of an older version and
+// serves it again.
+func (rep *repository) Revert(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	var data map[string]string
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	user, ok := rep.checkOwner(c, repository)
+	if !ok {
+		return
+	}
+	branch := data["branch"]
+	if branch == "" {
+		branch = versions.DefaultBranch
+	}
+	head, err := rep.vs.Head(context.Background(), repository.Username, repository.FolderName, branch)
+	if err == versions.ErrNotFound {
+		c.JSON(http.StatusNotFound, fmt.Sprintf("Cannot find the branch %s", branch))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if data["version"] == "" {
+		c.JSON(http.StatusBadRequest, "The version to revert to is missing")
+		return
+	}
+	target, ok := rep.resolveVersion(c, repository, data["version"])
+	if !ok {
+		return
+	}
+	if target.Digest == head.Digest {
+		c.JSON(http.StatusConflict, fmt.Sprintf("The branch %s is already at %s", branch, target.Digest))
+		return
+	}
+	if _, err = rep.vs.Manifest(context.Background(), target); err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	archive, err := rep.vs.Revert(context.Background(), target, branch, head, user.Username, data["message"])
+	if err == versions.ErrStale {
+		c.JSON(http.StatusConflict, fmt.Sprintf("The branch %s moved while reverting, try again", branch))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = rep.vs.PublishHead(context.Background(), "../"+utils.ROOT, repository.Username, repository.FolderName, branch)
+	if err != nil {
+		rep.vs.Unrecord(context.Background(), archive, branch, head)
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, archive)
+}
+
+// Download sends a version of the repository as a zip archive, the last
+// one unless the version query names a digest prefix or a tag.
+func (rep *repository) Download(c *gin.Context) {
+	repository, ok := rep.getRepository(c)
+	if !ok {
+		return
+	}
+	archive, ok := rep.resolveVersion(c, repository, c.Query("version"))
+	if !ok {
+		return
+	}
+	manifest, err := rep.vs.Manifest(context.Background(), archive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := fmt.Sprintf("%s-%s.zip", repository.FolderName, archive.Digest[:12])
+	if tag := c.Query("version"); versions.ValidName(tag) {
+		name = fmt.Sprintf("%s-%s.zip", repository.FolderName, tag)
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if err = rep.vs.Blobs.WriteZip(c.Writer, manifest); err != nil {
+		// the headers are gone already, all we can do is cut the download
+		c.Error(err)
+		c.Abort()
+	}
+}
+
+// checkOwner returns the logged in user if they own the repository, it
+// answers the request itself otherwise.
+func (rep *repository) checkOwner(c *gin.Context, repository *models.Repository) (*models.User, bool) {
+	token, err := rep.tk.ExtractTokenMetadata(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	oid, err := primitive.ObjectIDFromHex(token.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "error while parsing objectID")
+		return nil, false
+	}
+	user := &models.User{}
+	err = rep.mg.UserCollection.FindOne(context.Background(), bson.M{"_id": oid}).Decode(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "error while parsing user object")
+		return nil, false
+	}
+	if user.Username != repository.Username {
+		c.JSON(http.StatusForbidden, fmt.Sprintf("Only %s can change this repository", repository.Username))
+		return nil, false
+	}
+	return user, true
+}
+
+// getRepository fetches the repository named by the id parameter, it
+// answers the request itself when it can't.
+func (rep *repository) getRepository(c *gin.Context) (*models.Repository, bool) {
+	_id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Error happen when fetching repository ID.")
+		return nil, false
+	}
+	filter := bson.M{"_id": _id}
+	repository := &models.Repository{}
+	err = rep.mg.ReposCollecion.FindOne(context.Background(), filter).Decode(repository)
+	if err != nil {
+		c.JSON(http.StatusNotFound, "Error happen when fetching repository detail.")
+		return nil, false
+	}
+	return repository, true
+}
+
+// resolveVersion finds the version named by ref, the last one when empty,
+// it answers the request itself when it can't.
+func (rep *repository) resolveVersion(c *gin.Context, repository *models.Repository, ref string) (*models.Archive, bool) {
+	archive, err := rep.vs.Resolve(context.Background(), repository.Username, repository.FolderName, ref)
+	switch err {
+	case nil:
+		return archive, true
+	case versions.ErrNotFound:
+		c.JSON(http.StatusNotFound, fmt.Sprintf("Cannot find the version %s", ref))
+	case versions.ErrAmbiguous:
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("The version %s is ambiguous", ref))
+	default:
+		c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return nil, false
 }
 
 func (rep *repository) GenerateReposUrl(c *gin.Context) {